@@ -0,0 +1,197 @@
+package main
+
+import (
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/fatih/color"
+)
+
+// Live messages only update the database every so often, a busy channel would otherwise write for every message
+const lastSeenSaveInterval = 30 * time.Second
+
+var (
+	catchUpMutex sync.Mutex
+
+	lastSeenMessages   = make(map[string]string) // channel ID -> newest live message not saved yet
+	catchingUpChannels = make(map[string]bool)   // channels a catch-up hasn't finished yet
+	catchUpLiveStart   = make(map[string]string) // channel ID -> oldest live message while catching up, where it stops
+	lastSeenMutex      sync.Mutex
+)
+
+// Registered channels with catch-up on, each only once
+func getCatchUpChannels() []string {
+	config := getConfig()
+	var channels []string
+	for i, item := range config.Channels {
+		if item.CatchUp == nil || !*item.CatchUp || !*item.Enabled {
+			continue
+		}
+		for _, channelID := range getRegisteredChannels(config, i) {
+			if channelID == "" || stringInSlice(channelID, channels) {
+				continue
+			}
+			// Forum channels only hold posts, and voice & stage channels aren't worth asking
+			if channel, err := bot.State.Channel(channelID); err == nil && channel.Type != discordgo.ChannelTypeGuildText &&
+				channel.Type != discordgo.ChannelTypeGuildNews {
+				continue
+			}
+			channels = append(channels, channelID)
+		}
+	}
+	return channels
+}
+
+// Remembers the newest message handled in a channel, so catching up knows where to start
+func setLastSeenMessage(m *discordgo.Message) {
+	channelConfig := getChannelConfig(m.ChannelID)
+	if channelConfig.CatchUp == nil || !*channelConfig.CatchUp {
+		return
+	}
+	lastSeenMutex.Lock()
+	if catchingUpChannels[m.ChannelID] {
+		if start := catchUpLiveStart[m.ChannelID]; start == "" || isMessageIDAfter(start, m.ID) {
+			catchUpLiveStart[m.ChannelID] = m.ID
+		}
+	}
+	if isMessageIDAfter(m.ID, lastSeenMessages[m.ChannelID]) {
+		lastSeenMessages[m.ChannelID] = m.ID
+	}
+	lastSeenMutex.Unlock()
+}
+
+func saveLastSeenMessages() {
+	lastSeenMutex.Lock()
+	pending := make(map[string]string)
+	for channelID, messageID := range lastSeenMessages {
+		// Catching up records its own progress, a live message would move past what it hasn't reached yet
+		if catchingUpChannels[channelID] {
+			continue
+		}
+		pending[channelID] = messageID
+		delete(lastSeenMessages, channelID)
+	}
+	lastSeenMutex.Unlock()
+	for channelID, messageID := range pending {
+		dbSaveLastSeenMessage(channelID, messageID)
+	}
+}
+
+func watchLastSeenMessages() {
+	ticker := time.NewTicker(lastSeenSaveInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		saveLastSeenMessages()
+	}
+}
+
+// Handles messages posted while the bot wasn't connected, for every channel with catch-up on
+func catchUpMissedMessages() {
+	// A reconnect during a catch-up would only repeat it
+	if !catchUpMutex.TryLock() {
+		return
+	}
+	defer catchUpMutex.Unlock()
+
+	// Start from the newest live message, and hold live ones back until each channel is caught up
+	saveLastSeenMessages()
+	channels := getCatchUpChannels()
+	lastSeenMutex.Lock()
+	for _, channelID := range channels {
+		catchingUpChannels[channelID] = true
+	}
+	lastSeenMutex.Unlock()
+
+	for _, channelID := range channels {
+		catchUpChannel(channelID)
+		lastSeenMutex.Lock()
+		delete(catchingUpChannels, channelID)
+		delete(catchUpLiveStart, channelID)
+		lastSeenMutex.Unlock()
+	}
+}
+
+// The oldest message handled live since catching up started in a channel, "" if none yet
+func getCatchUpLiveStart(channelID string) string {
+	lastSeenMutex.Lock()
+	defer lastSeenMutex.Unlock()
+	return catchUpLiveStart[channelID]
+}
+
+func catchUpChannel(channelID string) {
+	logPrefixHere := color.CyanString("[catchUpChannel]")
+	channelConfig := getChannelConfig(channelID)
+
+	// First time, start from the newest message so there's something to go on next time
+	lastSeen := dbFindLastSeenMessage(channelID)
+	if lastSeen == "" {
+		messages, err := bot.ChannelMessages(channelID, 1, "", "", "")
+		if err != nil {
+			log.Println(logPrefixHere, color.HiRedString("Failed to request newest message for %s:\t%s", channelID, err))
+		} else if len(messages) > 0 {
+			dbSaveLastSeenMessage(channelID, messages[0].ID)
+		}
+		return
+	}
+	after := lastSeen
+	if channelConfig.CatchUpHours != nil && *channelConfig.CatchUpHours > 0 {
+		oldest := timeToSnowflake(time.Now().Add(-time.Duration(*channelConfig.CatchUpHours) * time.Hour))
+		if isMessageIDAfter(oldest, after) {
+			after = oldest
+		}
+	}
+
+	guildID := ""
+	if channel, err := bot.State.Channel(channelID); err == nil {
+		guildID = channel.GuildID
+	}
+
+	count := 0
+	for {
+		messages, err := bot.ChannelMessages(channelID, 100, "", after, "")
+		if err != nil {
+			log.Println(logPrefixHere, color.HiRedString("Failed to request missed messages for %s:\t%s", channelID, err))
+			break
+		}
+		if len(messages) == 0 {
+			break
+		}
+		// Oldest first, as they would have arrived
+		sort.Slice(messages, func(i, j int) bool {
+			return isMessageIDAfter(messages[j].ID, messages[i].ID)
+		})
+		// Stop where live messages took over, those were handled as they arrived
+		reachedLive := false
+		if liveStart := getCatchUpLiveStart(channelID); liveStart != "" {
+			for i, message := range messages {
+				if !isMessageIDAfter(liveStart, message.ID) {
+					messages, reachedLive = messages[:i], true
+					break
+				}
+			}
+			if len(messages) == 0 {
+				break
+			}
+		}
+		for _, message := range messages {
+			// Messages from the API don't say which server they're in
+			if message.GuildID == "" {
+				message.GuildID = guildID
+			}
+			handleMessage(message, false)
+		}
+		count += len(messages)
+		after = messages[len(messages)-1].ID
+		dbSaveLastSeenMessage(channelID, after)
+		if reachedLive {
+			break
+		}
+	}
+
+	if count > 0 {
+		log.Println(logPrefixHere, color.HiCyanString("Caught up on %d message(s) missed in %s", count, channelID))
+	}
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/hako/durafmt"
+)
+
+// One-off modes that run against the database and exit instead of starting the bot.
+// Returns false when no mode was requested.
+func runCommandLine(args []string) (bool, int) {
+	if len(args) == 0 {
+		return false, 0
+	}
+
+	flags := flag.NewFlagSet(projectName, flag.ContinueOnError)
+	exportPath := flags.String("export", "", "export download records to this file and exit")
+	importPath := flags.String("import", "", "merge download records from this export file and exit")
+	format := flags.String("format", "", "export file format, jsonl or csv (default from the file extension)")
+	channelID := flags.String("channel", "", "only export or verify records from this channel ID, or the channel to record indexed files under")
+	userID := flags.String("user", "", "only export records from this user ID")
+	since := flags.String("since", "", "only export records downloaded on or after this date (YYYY-MM-DD or RFC3339)")
+	until := flags.String("until", "", "only export records downloaded up to this date (YYYY-MM-DD or RFC3339)")
+	verify := flags.Bool("verify", false, "check downloaded files against their records and exit")
+	purge := flags.Bool("purge", false, "with -verify, remove records of missing or changed files")
+	requeue := flags.Bool("requeue", false, "with -verify, remove records of missing or changed files and queue their links again")
+	orphans := flags.Bool("orphans", false, "with -verify, also list files in channel destinations that have no record")
+	index := flags.String("index", "", "record every file in this folder as downloaded and exit")
+	links := flags.String("links", "", "with -index, list of links to match the files to, one per line")
+	checkConfig := flags.Bool("check-config", false, "check the settings file for problems and exit, non-zero if it can't be used")
+	if err := flags.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return true, 0
+		}
+		return true, 2
+	}
+
+	if *checkConfig {
+		return true, runCheckConfigCommandLine()
+	}
+	if *index != "" {
+		return true, runIndexCommandLine(indexOptions{Folder: *index, ChannelID: *channelID, LinksFile: *links})
+	}
+	if *verify {
+		return true, runVerifyCommandLine(*channelID, *purge, *requeue, *orphans)
+	}
+	if *exportPath == "" && *importPath == "" {
+		log.Println(color.HiRedString("Nothing to do, use -export, -import, -verify, -index or -check-config (see -help)"))
+		return true, 2
+	}
+
+	path := *exportPath
+	if path == "" {
+		path = *importPath
+	}
+	if *format == "" {
+		*format = getExportFormat(path)
+	} else if !isExportFormat(*format) {
+		log.Println(color.HiRedString("Unknown format \"%s\", use jsonl or csv", *format))
+		return true, 2
+	}
+
+	filter := downloadFilter{ChannelID: *channelID, UserID: *userID}
+	var err error
+	if *since != "" {
+		if filter.Since, err = parseExportDate(*since, false); err != nil {
+			log.Println(color.HiRedString("-since: %s", err))
+			return true, 2
+		}
+	}
+	if *until != "" {
+		if filter.Until, err = parseExportDate(*until, true); err != nil {
+			log.Println(color.HiRedString("-until: %s", err))
+			return true, 2
+		}
+	}
+
+	log.Println(color.YellowString("Opening database..."))
+	if err := openDatabase(); err != nil {
+		log.Println(color.HiRedString("Unable to open database: %s", err))
+		return true, 1
+	}
+	defer myDB.Close()
+
+	if *exportPath != "" {
+		count, err := exportDownloadsToFile(*exportPath, *format, filter)
+		if err != nil {
+			log.Println(color.HiRedString("Export failed: %s", err))
+			return true, 1
+		}
+		log.Println(color.HiGreenString("Exported %d download record(s) to \"%s\"", count, *exportPath))
+	} else {
+		read, imported, err := importDownloadsFromFile(*importPath, *format)
+		if err != nil {
+			log.Println(color.HiRedString("Import failed: %s", err))
+			return true, 1
+		}
+		log.Println(color.HiGreenString("Imported %d of %d download record(s) from \"%s\", %d already in the database",
+			imported, read, *importPath, read-imported))
+	}
+	return true, 0
+}
+
+func runVerifyCommandLine(channelID string, purge bool, requeue bool, orphans bool) int {
+	options := verifyOptions{Filter: downloadFilter{ChannelID: channelID}, Orphans: orphans}
+	if requeue {
+		options.Action = verifyActionRequeue
+	} else if purge {
+		options.Action = verifyActionPurge
+	}
+
+	// Channel destinations are needed for orphans & requeueing
+	log.Println(color.YellowString("Loading settings from \"%s\"...", configPath))
+	loadConfig()
+	log.Println(color.YellowString("Opening database..."))
+	if err := openDatabase(); err != nil {
+		log.Println(color.HiRedString("Unable to open database: %s", err))
+		return 1
+	}
+	defer myDB.Close()
+
+	verifyStartTime := time.Now()
+	result, err := verifyDownloads(options, func(result *verifyResult) {
+		log.Println(color.CyanString("Checked %d of %d download record(s)...", result.Checked, result.Total))
+	})
+	if err != nil {
+		log.Println(color.HiRedString("Verification failed: %s", err))
+		return 1
+	}
+	log.Println(color.HiGreenString("Checked %d download record(s) in %s: %d missing, %d changed",
+		result.Checked, durafmt.ParseShort(time.Since(verifyStartTime)).String(), len(result.Missing), len(result.Mismatched)))
+	if orphans {
+		log.Println(color.HiGreenString("%d file(s) without a record", len(result.Orphaned)))
+	}
+	if options.Action != verifyActionNone {
+		log.Println(color.HiGreenString("Removed %d stale record(s), queued %d link(s) to download on next start",
+			result.Purged, result.Requeued))
+	}
+	return 0
+}
+
+func runIndexCommandLine(options indexOptions) int {
+	// Channel destinations & the duplicate image filter come from settings
+	log.Println(color.YellowString("Loading settings from \"%s\"...", configPath))
+	loadConfig()
+	config := getConfig()
+	log.Println(color.YellowString("Opening database..."))
+	if err := openDatabase(); err != nil {
+		log.Println(color.HiRedString("Unable to open database: %s", err))
+		return 1
+	}
+	defer myDB.Close()
+	if config.FilterDuplicateImages {
+		loadImgStore()
+	}
+
+	indexStartTime := time.Now()
+	result, err := indexFolder(options, func(result *indexResult) {
+		log.Println(color.CyanString("Scanned %d file(s), %d indexed...", result.Scanned, result.Indexed))
+	})
+	if err != nil {
+		log.Println(color.HiRedString("Indexing failed: %s", err))
+		return 1
+	}
+	log.Println(color.HiGreenString("Indexed %d of %d file(s) in %s: %d already in the database, %d matched to links, %d added to the duplicate image filter, %d failed",
+		result.Indexed, result.Scanned, durafmt.ParseShort(time.Since(indexStartTime)).String(),
+		result.Known, result.Matched, result.Images, result.Failures))
+	if result.ChannelID == "" {
+		log.Println(color.YellowString("No single channel's destination holds this folder, so the files aren't recorded under a channel. " +
+			"Folders of channels lists, servers & categories need -channel <Channel ID>."))
+	}
+	return 0
+}
+
+func runCheckConfigCommandLine() int {
+	log.Println(color.YellowString("Checking settings in \"%s\"...", configPath))
+	checkedConfig, warnings, err := readConfig(configPath)
+	for _, warning := range warnings {
+		log.Println(color.YellowString("Warning: %s", warning))
+	}
+	if err != nil {
+		for _, problem := range strings.Split(err.Error(), "\n") {
+			log.Println(color.HiRedString("Error: %s", problem))
+		}
+		log.Println(color.HiRedString("Settings can't be used"))
+		return 1
+	}
+	log.Println(color.HiGreenString("Settings are valid, %d channel setting(s) & %d admin channel(s), %d warning(s)",
+		len(checkedConfig.Channels), len(checkedConfig.AdminChannels), len(warnings)))
+	return 0
+}
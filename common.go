@@ -3,10 +3,12 @@ package main
 import (
 	"encoding/json"
 	"fmt"
+	"io"
 	"log"
 	"net/http"
 	"os"
 	"path"
+	"runtime"
 	"strconv"
 	"strings"
 	"time"
@@ -18,8 +20,24 @@ import (
 
 var (
 	pathBlacklist = []string{"/", "\\", "<", ">", ":", "\"", "|", "?", "*"}
+	// Characters that can't be in a file or folder name on this system
+	filenameBlacklist = getFilenameBlacklist()
 )
 
+func getFilenameBlacklist() []string {
+	if runtime.GOOS == "windows" {
+		return pathBlacklist
+	}
+	return []string{"/", "\x00"}
+}
+
+func removeFromString(value string, blacklist []string) string {
+	for _, key := range blacklist {
+		value = strings.ReplaceAll(value, key, "")
+	}
+	return value
+}
+
 type githubReleaseApiObject struct {
 	TagName string `json:"tag_name"`
 }
@@ -111,6 +129,20 @@ func formatNumber(n int64) string {
 	}
 }
 
+func formatBytes(n int64) string {
+	units := []string{"B", "KB", "MB", "GB", "TB"}
+	size := float64(n)
+	i := 0
+	for size >= 1024 && i < len(units)-1 {
+		size /= 1024
+		i++
+	}
+	if i == 0 {
+		return fmt.Sprintf("%d %s", n, units[i])
+	}
+	return fmt.Sprintf("%.1f %s", size, units[i])
+}
+
 func formatNumberShort(x int64) string {
 	if x > 1000 {
 		formattedNumber := formatNumber(x)
@@ -154,3 +186,24 @@ func getJSONwithHeaders(url string, target interface{}, headers map[string]strin
 
 	return json.NewDecoder(r.Body).Decode(target)
 }
+
+func saveURLToFile(url string, path string) error {
+	r, err := http.Get(url)
+	if err != nil {
+		return err
+	}
+	defer r.Body.Close()
+	if r.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %s", r.Status)
+	}
+
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(file, r.Body); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
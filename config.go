@@ -3,10 +3,12 @@ package main
 import (
 	"bufio"
 	"encoding/json"
+	"errors"
 	"io/ioutil"
 	"log"
 	"os"
 	"strings"
+	"sync/atomic"
 
 	"github.com/bwmarrin/discordgo"
 	"github.com/fatih/color"
@@ -43,15 +45,17 @@ var (
 	cdAllowSkipping        bool   = true
 	cdScanOwnMessages      bool   = false
 	cdGithubUpdateChecking bool   = true
+	cdWatchSettings        bool   = true
+	cdMessageContentIntent bool   = true
 	// Appearance
-	cdPresenceEnabled bool               = true
-	cdPresenceStatus  string             = string(discordgo.StatusIdle)
-	cdPresenceType    discordgo.GameType = discordgo.GameTypeGame
-	cdInflateCount    int64              = 0
+	cdPresenceEnabled bool                   = true
+	cdPresenceStatus  string                 = string(discordgo.StatusIdle)
+	cdPresenceType    discordgo.ActivityType = discordgo.ActivityTypeGame
+	cdInflateCount    int64                  = 0
 )
 
-func defaultConfiguration() configuration {
-	return configuration{
+func defaultConfiguration() *configuration {
+	return &configuration{
 		// Required
 		Credentials: configurationCredentials{
 			Token:    placeholderToken,
@@ -66,9 +70,19 @@ func defaultConfiguration() configuration {
 		ScanOwnMessages:                cdScanOwnMessages,
 		FilterDuplicateImages:          false,
 		FilterDuplicateImagesThreshold: 25,
+		FilterDuplicateImagesMaxSize:   20,
 		DownloadRetryMax:               3,
 		DownloadTimeout:                60,
+		PartialDownloadMaxAge:          24,
+		DownloadWorkers:                4,
+		DownloadWorkersPerDomain:       2,
+		DownloadRateLimit:              5,
+		DownloadRateBurst:              5,
+		DownloadRetryBackoff:           5,
+		DownloadRetryBackoffMax:        300,
 		GithubUpdateChecking:           cdGithubUpdateChecking,
+		WatchSettings:                  cdWatchSettings,
+		MessageContentIntent:           cdMessageContentIntent,
 		// Appearance
 		PresenceEnabled:    cdPresenceEnabled,
 		PresenceStatus:     cdPresenceStatus,
@@ -90,19 +104,34 @@ type configuration struct {
 	ScanOwnMessages                bool                        `json:"scanOwnMessages"`                          // optional, defaults
 	FilterDuplicateImages          bool                        `json:"filterDuplicateImages,omitempty"`          // optional, defaults
 	FilterDuplicateImagesThreshold float64                     `json:"filterDuplicateImagesThreshold,omitempty"` // optional, defaults
+	FilterDuplicateImagesMaxSize   int64                       `json:"filterDuplicateImagesMaxSize,omitempty"`   // optional, defaults
 	DownloadRetryMax               int                         `json:"downloadRetryMax,omitempty"`               // optional, defaults
 	DownloadTimeout                int                         `json:"downloadTimeout,omitempty"`                // optional, defaults
+	PartialDownloadMaxAge          int                         `json:"partialDownloadMaxAge,omitempty"`          // optional, defaults
+	DownloadWorkers                int                         `json:"downloadWorkers,omitempty"`                // optional, defaults
+	DownloadWorkersPerDomain       int                         `json:"downloadWorkersPerDomain,omitempty"`       // optional, defaults
+	DownloadRateLimit              float64                     `json:"downloadRateLimit,omitempty"`              // optional, defaults
+	DownloadRateBurst              int                         `json:"downloadRateBurst,omitempty"`              // optional, defaults
+	DownloadRetryBackoff           int                         `json:"downloadRetryBackoff,omitempty"`           // optional, defaults
+	DownloadRetryBackoffMax        int                         `json:"downloadRetryBackoffMax,omitempty"`        // optional, defaults
+	Domains                        []configurationDomain       `json:"domains,omitempty"`                        // optional
+	PlaceholderHashes              []string                    `json:"placeholderHashes,omitempty"`              // optional
+	FfmpegPath                     string                      `json:"ffmpegPath,omitempty"`                     // optional
 	GithubUpdateChecking           bool                        `json:"githubUpdateChecking"`                     // optional, defaults
+	WatchSettings                  bool                        `json:"watchSettings"`                            // optional, defaults
+	MessageContentIntent           bool                        `json:"messageContentIntent"`                     // optional, defaults
+
+	ExternalDownloaders []configurationExternalDownloader `json:"externalDownloaders,omitempty"` // optional
 	// Appearance
-	PresenceEnabled          bool               `json:"presenceEnabled"`                    // optional, defaults
-	PresenceStatus           string             `json:"presenceStatus"`                     // optional, defaults
-	PresenceType             discordgo.GameType `json:"presenceType,omitempty"`             // optional, defaults
-	PresenceOverwrite        *string            `json:"presenceOverwrite,omitempty"`        // optional, unused if undefined
-	PresenceOverwriteDetails *string            `json:"presenceOverwriteDetails,omitempty"` // optional, unused if undefined
-	PresenceOverwriteState   *string            `json:"presenceOverwriteState,omitempty"`   // optional, unused if undefined
-	FilenameDateFormat       string             `json:"filenameDateFormat,omitempty"`       // optional, defaults
-	EmbedColor               *string            `json:"embedColor,omitempty"`               // optional, defaults to role if undefined, then defaults random if no role color
-	InflateCount             *int64             `json:"inflateCount,omitempty"`             // optional, defaults to 0 if undefined
+	PresenceEnabled          bool                   `json:"presenceEnabled"`                    // optional, defaults
+	PresenceStatus           string                 `json:"presenceStatus"`                     // optional, defaults
+	PresenceType             discordgo.ActivityType `json:"presenceType,omitempty"`             // optional, defaults
+	PresenceOverwrite        *string                `json:"presenceOverwrite,omitempty"`        // optional, unused if undefined
+	PresenceOverwriteDetails *string                `json:"presenceOverwriteDetails,omitempty"` // optional, unused if undefined
+	PresenceOverwriteState   *string                `json:"presenceOverwriteState,omitempty"`   // optional, unused if undefined
+	FilenameDateFormat       string                 `json:"filenameDateFormat,omitempty"`       // optional, defaults
+	EmbedColor               *string                `json:"embedColor,omitempty"`               // optional, defaults to role if undefined, then defaults random if no role color
+	InflateCount             *int64                 `json:"inflateCount,omitempty"`             // optional, defaults to 0 if undefined
 	// Channels
 	Channels []configurationChannel `json:"channels"` // required
 
@@ -117,10 +146,14 @@ type configuration struct {
 // Needed for settings used without redundant nil checks, and settings defaulting + creation
 var (
 	// Setup
-	ccdEnabled       bool = true
-	ccdAllowCommands bool = true
-	ccdErrorMessages bool = true
-	ccdScanEdits     bool = true
+	ccdEnabled           bool = true
+	ccdAllowCommands     bool = true
+	ccdErrorMessages     bool = true
+	ccdScanEdits         bool = true
+	ccdCatchUp           bool = true
+	ccdCatchUpHours      int  = 24
+	ccdIncludeThreads    bool = false
+	ccdIncludeForumPosts bool = false
 	// Appearance
 	ccdUpdatePresence           bool     = true
 	ccdReactWhenDownloaded      bool     = true
@@ -157,12 +190,21 @@ type configurationChannel struct {
 	// Main
 	ChannelID   string    `json:"channel"`            // required
 	ChannelIDs  *[]string `json:"channels,omitempty"` // alternative to ChannelID
+	GuildID     string    `json:"guild,omitempty"`    // alternative to ChannelID, every channel in the server
+	CategoryID  string    `json:"category,omitempty"` // alternative to ChannelID, every channel in the category
 	Destination string    `json:"destination"`        // required
+	// Guild & Category Registration
+	IncludeChannels *[]string `json:"includeChannels,omitempty"` // optional, channel or category IDs, only these are covered
+	ExcludeChannels *[]string `json:"excludeChannels,omitempty"` // optional, channel or category IDs left out
 	// Setup
-	Enabled       *bool `json:"enabled,omitempty"`       // optional, defaults
-	AllowCommands *bool `json:"allowCommands,omitempty"` // optional, defaults
-	ErrorMessages *bool `json:"errorMessages,omitempty"` // optional, defaults
-	ScanEdits     *bool `json:"scanEdits,omitempty"`     // optional, defaults
+	Enabled           *bool `json:"enabled,omitempty"`           // optional, defaults
+	AllowCommands     *bool `json:"allowCommands,omitempty"`     // optional, defaults
+	ErrorMessages     *bool `json:"errorMessages,omitempty"`     // optional, defaults
+	ScanEdits         *bool `json:"scanEdits,omitempty"`         // optional, defaults
+	CatchUp           *bool `json:"catchUp,omitempty"`           // optional, defaults
+	CatchUpHours      *int  `json:"catchUpHours,omitempty"`      // optional, defaults
+	IncludeThreads    *bool `json:"includeThreads,omitempty"`    // optional, defaults
+	IncludeForumPosts *bool `json:"includeForumPosts,omitempty"` // optional, defaults
 	// Appearance
 	UpdatePresence           *bool     `json:"updatePresence,omitempty"`           // optional, defaults
 	ReactWhenDownloaded      *bool     `json:"reactWhenDownloaded,omitempty"`      // optional, defaults
@@ -181,15 +223,22 @@ type configurationChannel struct {
 	DivideFoldersByChannel *bool     `json:"divideFoldersByChannel,omitempty"` // optional, defaults
 	DivideFoldersByUser    *bool     `json:"divideFoldersByUser,omitempty"`    // optional, defaults
 	DivideFoldersByType    *bool     `json:"divideFoldersByType,omitempty"`    // optional, defaults
+	PathTemplate           *string   `json:"pathTemplate,omitempty"`           // optional, replaces divideFoldersBy settings
+	FilenameTemplate       *string   `json:"filenameTemplate,omitempty"`       // optional
+	DateSource             *string   `json:"dateSource,omitempty"`             // optional, defaults to message
 	SaveImages             *bool     `json:"saveImages,omitempty"`             // optional, defaults
 	SaveVideos             *bool     `json:"saveVideos,omitempty"`             // optional, defaults
 	SaveAudioFiles         *bool     `json:"saveAudioFiles,omitempty"`         // optional, defaults
 	SaveTextFiles          *bool     `json:"saveTextFiles,omitempty"`          // optional, defaults
 	SaveOtherFiles         *bool     `json:"saveOtherFiles,omitempty"`         // optional, defaults
 	SavePossibleDuplicates *bool     `json:"savePossibleDuplicates,omitempty"` // optional, defaults
+	DuplicatePolicy        *string   `json:"duplicatePolicy,omitempty"`        // optional, defaults to save
 	ExtensionBlacklist     *[]string `json:"extensionBlacklist,omitempty"`     // optional, defaults
 	DomainBlacklist        *[]string `json:"domainBlacklist,omitempty"`        // optional, defaults
 	SaveAllLinksToFile     *string   `json:"saveAllLinksToFile,omitempty"`     // optional
+	// Extractors
+	EnabledExtractors  *[]string `json:"enabledExtractors,omitempty"`  // optional
+	DisabledExtractors *[]string `json:"disabledExtractors,omitempty"` // optional
 
 	/* IDEAS / TODO:
 
@@ -215,54 +264,113 @@ type configurationAdminChannel struct {
 	 */
 }
 
+type configurationDomain struct {
+	// Required
+	Domain string `json:"domain"` // required, also applies to subdomains
+	// Overwrite Global Settings
+	RateLimit       *float64 `json:"rateLimit,omitempty"`       // optional
+	RateBurst       *int     `json:"rateBurst,omitempty"`       // optional
+	RetryBackoff    *int     `json:"retryBackoff,omitempty"`    // optional
+	RetryBackoffMax *int     `json:"retryBackoffMax,omitempty"` // optional
+}
+
+type configurationExternalDownloader struct {
+	// Required
+	Program string   `json:"program"` // required, "yt-dlp" or "gallery-dl"
+	Domains []string `json:"domains"` // required, also applies to subdomains
+	// Optional
+	Path          string   `json:"path,omitempty"`          // optional, defaults to program
+	Arguments     []string `json:"arguments,omitempty"`     // optional
+	Timeout       *int     `json:"timeout,omitempty"`       // optional, defaults
+	MaxConcurrent *int     `json:"maxConcurrent,omitempty"` // optional, defaults
+}
+
 var (
-	config = defaultConfiguration()
+	// Settings in use, replaced as a whole when reloaded. Read through getConfig, once per operation,
+	// so everything an operation does goes by the same settings.
+	currentConfig atomic.Pointer[configuration]
 )
 
+func init() {
+	currentConfig.Store(defaultConfiguration())
+}
+
+func getConfig() *configuration {
+	return currentConfig.Load()
+}
+
 func loadConfig() {
 	// Load settings
-	file, err := os.Open(configPath)
-	defer file.Close()
-	if err != nil {
+	if _, err := os.Stat(configPath); err != nil {
 		log.Println(color.HiRedString("Failed to open settings file...\t%s", err))
 		createConfig()
 		properExit()
-	} else {
-		decoder := json.NewDecoder(file)
-		err := decoder.Decode(&config)
-		if err != nil {
-			log.Println(color.HiRedString("Settings failed to decode...\t%s", err))
-			log.Println(logPrefixHelper, color.MagentaString("Please ensure you're following proper JSON format syntax."))
-			properExit()
-		}
+	}
+	newConfig, warnings, err := readConfig(configPath)
+	for _, warning := range warnings {
+		log.Println(color.YellowString("Settings warning: %s", warning))
+	}
+	if err == errNoCredentials {
+		log.Println(color.HiRedString("No valid discord login found. Token, Email, and Password are all invalid..."))
+		log.Println(color.HiYellowString("Please save your credentials & info into \"%s\" then restart...", configPath))
+		log.Println(logPrefixHelper, color.MagentaString("If your credentials are already properly saved, please ensure you're following proper JSON format syntax."))
+		log.Println(logPrefixHelper, color.MagentaString("You DO NOT NEED `Token` *AND* `Email`+`Password`, just one OR the other."))
+		properExit()
+	} else if err != nil {
+		log.Println(color.HiRedString("Settings failed to load...\n%s", err))
+		log.Println(logPrefixHelper, color.MagentaString("Please ensure you're following proper JSON format syntax. Run with --check-config to check settings without starting."))
+		properExit()
+	}
+	currentConfig.Store(newConfig)
+	configModTime = getConfigModTime()
+	logConfig()
+}
 
-		// Channel Config Defaults
-		// this is dumb but don't see a better way to initialize defaults
-		for i := 0; i < len(config.Channels); i++ {
-			channelDefault(&config.Channels[i])
-		}
+// Parses & checks a settings file with defaults filled in, without touching the settings in use.
+// Warnings are for things that are likely mistakes but don't stop the settings from being used.
+func readConfig(path string) (*configuration, []string, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	newConfig := defaultConfiguration()
+	if err := json.Unmarshal(data, newConfig); err != nil {
+		return nil, nil, describeJSONError(data, err)
+	}
+	warnings := findUnknownSettings(data)
 
-		// Debug Output
-		if config.DebugOutput {
-			s, err := json.MarshalIndent(config, "", "\t")
-			if err != nil {
-				log.Println(logPrefixDebug, color.HiRedString("Failed to output settings...\t%s", err))
-			} else {
-				log.Println(logPrefixDebug, color.HiYellowString("Parsed Fixed Settings into JSON:\n\n"),
-					color.YellowString(string(s)),
-				)
-			}
-		}
+	// Channel Config Defaults
+	// this is dumb but don't see a better way to initialize defaults
+	for i := 0; i < len(newConfig.Channels); i++ {
+		channelDefault(&newConfig.Channels[i])
+	}
 
-		// Credentials Check
-		if (config.Credentials.Token == "" || config.Credentials.Token == placeholderToken) &&
-			(config.Credentials.Email == "" || config.Credentials.Email == placeholderEmail) &&
-			(config.Credentials.Password == "" || config.Credentials.Password == placeholderPassword) {
-			log.Println(color.HiRedString("No valid discord login found. Token, Email, and Password are all invalid..."))
-			log.Println(color.HiYellowString("Please save your credentials & info into \"%s\" then restart...", configPath))
-			log.Println(logPrefixHelper, color.MagentaString("If your credentials are already properly saved, please ensure you're following proper JSON format syntax."))
-			log.Println(logPrefixHelper, color.MagentaString("You DO NOT NEED `Token` *AND* `Email`+`Password`, just one OR the other."))
-			properExit()
+	// Credentials Check
+	if (newConfig.Credentials.Token == "" || newConfig.Credentials.Token == placeholderToken) &&
+		(newConfig.Credentials.Email == "" || newConfig.Credentials.Email == placeholderEmail) &&
+		(newConfig.Credentials.Password == "" || newConfig.Credentials.Password == placeholderPassword) {
+		return nil, warnings, errNoCredentials
+	}
+
+	problems, validationWarnings := validateConfig(newConfig)
+	warnings = append(warnings, validationWarnings...)
+	if len(problems) > 0 {
+		return nil, warnings, errors.New(strings.Join(problems, "\n"))
+	}
+	return newConfig, warnings, nil
+}
+
+// Debug Output
+func logConfig() {
+	config := getConfig()
+	if config.DebugOutput {
+		s, err := json.MarshalIndent(config, "", "\t")
+		if err != nil {
+			log.Println(logPrefixDebug, color.HiRedString("Failed to output settings...\t%s", err))
+		} else {
+			log.Println(logPrefixDebug, color.HiYellowString("Parsed Fixed Settings into JSON:\n\n"),
+				color.YellowString(string(s)),
+			)
 		}
 	}
 }
@@ -282,6 +390,18 @@ func channelDefault(channel *configurationChannel) {
 	if channel.ScanEdits == nil {
 		channel.ScanEdits = &ccdScanEdits
 	}
+	if channel.CatchUp == nil {
+		channel.CatchUp = &ccdCatchUp
+	}
+	if channel.CatchUpHours == nil {
+		channel.CatchUpHours = &ccdCatchUpHours
+	}
+	if channel.IncludeThreads == nil {
+		channel.IncludeThreads = &ccdIncludeThreads
+	}
+	if channel.IncludeForumPosts == nil {
+		channel.IncludeForumPosts = &ccdIncludeForumPosts
+	}
 	// Appearance
 	if channel.UpdatePresence == nil {
 		channel.UpdatePresence = &ccdUpdatePresence
@@ -432,6 +552,8 @@ func createConfig() {
 		PresenceType:    cdPresenceType,
 
 		GithubUpdateChecking: cdGithubUpdateChecking,
+		WatchSettings:        cdWatchSettings,
+		MessageContentIntent: cdMessageContentIntent,
 		DebugOutput:          cdDebugOutput,
 	}
 
@@ -478,42 +600,152 @@ func createConfig() {
 }
 
 func isChannelRegistered(ChannelID string) bool {
-	for _, item := range config.Channels {
+	if _, found := resolveChannelConfig(ChannelID); found {
+		return true
+	}
+	// Threads & forum posts of a registered channel
+	_, found := getThreadChannelConfig(ChannelID)
+	return found
+}
+
+func getChannelConfig(ChannelID string) configurationChannel {
+	if item, found := resolveChannelConfig(ChannelID); found {
+		return item
+	}
+	if item, found := getThreadChannelConfig(ChannelID); found {
+		return item
+	}
+	return configurationChannel{}
+}
+
+// Config for a channel registered by ID, or else through its category, or else its server
+func resolveChannelConfig(ChannelID string) (configurationChannel, bool) {
+	config := getConfig()
+	if i := resolveChannelConfigIndex(config, ChannelID); i != -1 {
+		return config.Channels[i], true
+	}
+	return configurationChannel{}, false
+}
+
+// Position in config.Channels of the entry a channel resolves to, -1 if none.
+// Positions are only good for the settings they were found in, a reload can move or remove entries.
+func resolveChannelConfigIndex(config *configuration, ChannelID string) int {
+	if i := findChannelConfigIndex(config, ChannelID); i != -1 {
+		return i
+	}
+	return findGroupChannelConfigIndex(config, ChannelID)
+}
+
+// Entry registered for exactly this channel
+func findChannelConfigIndex(config *configuration, ChannelID string) int {
+	for i, item := range config.Channels {
 		// Single Channel Config
 		if ChannelID == item.ChannelID {
-			return true
+			return i
 		}
 		// Multi-Channel Config
 		if item.ChannelIDs != nil {
 			for _, subchannel := range *item.ChannelIDs {
 				if ChannelID == subchannel {
-					return true
+					return i
 				}
 			}
 		}
 	}
-	return false
+	return -1
 }
 
-func getChannelConfig(ChannelID string) configurationChannel {
+func hasGroupChannelConfigs(config *configuration) bool {
 	for _, item := range config.Channels {
-		// Single Channel Config
-		if ChannelID == item.ChannelID {
-			return item
+		if item.GuildID != "" || item.CategoryID != "" {
+			return true
 		}
-		// Multi-Channel Config
-		if item.ChannelIDs != nil {
-			for _, subchannel := range *item.ChannelIDs {
-				if ChannelID == subchannel {
-					return item
-				}
+	}
+	return false
+}
+
+// Whether a guild or category entry covers a channel, going by its include & exclude lists
+func (item configurationChannel) isCoveringChannel(channel *discordgo.Channel) bool {
+	// Threads go by the channel they're in
+	if channel.Type == discordgo.ChannelTypeGuildCategory || channel.IsThread() {
+		return false
+	}
+	listed := func(list *[]string) bool {
+		return list != nil && (stringInSlice(channel.ID, *list) ||
+			(channel.ParentID != "" && stringInSlice(channel.ParentID, *list)))
+	}
+	if item.IncludeChannels != nil && len(*item.IncludeChannels) > 0 && !listed(item.IncludeChannels) {
+		return false
+	}
+	return !listed(item.ExcludeChannels)
+}
+
+// Entry covering a channel through its category or server, looked up each time so new channels are picked up
+func findGroupChannelConfigIndex(config *configuration, ChannelID string) int {
+	if !hasGroupChannelConfigs(config) {
+		return -1
+	}
+	// Checked for every message, channels that aren't in state aren't in any server the bot is in
+	channel, err := getStateChannel(ChannelID)
+	if err != nil || channel.GuildID == "" {
+		return -1
+	}
+	// Category Config
+	if channel.ParentID != "" {
+		for i, item := range config.Channels {
+			if item.CategoryID == channel.ParentID && item.isCoveringChannel(channel) {
+				return i
 			}
 		}
 	}
-	return configurationChannel{}
+	// Guild Config
+	for i, item := range config.Channels {
+		if item.CategoryID == "" && item.GuildID == channel.GuildID && item.isCoveringChannel(channel) {
+			return i
+		}
+	}
+	return -1
+}
+
+// Channel IDs the entry at a position in config.Channels applies to. Guild & category entries list
+// the channels currently in state that don't resolve to another entry.
+func getRegisteredChannels(config *configuration, index int) []string {
+	item := config.Channels[index]
+	if item.ChannelIDs != nil {
+		return *item.ChannelIDs
+	}
+	if item.ChannelID != "" {
+		return []string{item.ChannelID}
+	}
+	if bot == nil || bot.State == nil {
+		return nil
+	}
+	guildID := item.GuildID
+	if item.CategoryID != "" {
+		category, err := bot.State.Channel(item.CategoryID)
+		if err != nil {
+			return nil
+		}
+		guildID = category.GuildID
+	}
+	guild, err := bot.State.Guild(guildID)
+	if err != nil {
+		return nil
+	}
+	var channels []string
+	for _, channel := range guild.Channels {
+		if item.CategoryID != "" && channel.ParentID != item.CategoryID {
+			continue
+		}
+		if resolveChannelConfigIndex(config, channel.ID) == index {
+			channels = append(channels, channel.ID)
+		}
+	}
+	return channels
 }
 
 func isAdminChannelRegistered(ChannelID string) bool {
+	config := getConfig()
 	if config.AdminChannels != nil {
 		for _, item := range config.AdminChannels {
 			if ChannelID == item.ChannelID {
@@ -525,6 +757,7 @@ func isAdminChannelRegistered(ChannelID string) bool {
 }
 
 func getAdminChannelConfig(ChannelID string) configurationAdminChannel {
+	config := getConfig()
 	if config.AdminChannels != nil {
 		for _, item := range config.AdminChannels {
 			if ChannelID == item.ChannelID {
@@ -548,17 +781,12 @@ func isCommandableChannel(m *discordgo.Message) bool {
 }
 
 func getBoundChannelsCount() int {
+	config := getConfig()
 	var channels []string
-	for _, item := range config.Channels {
-		if item.ChannelID != "" {
-			if !stringInSlice(item.ChannelID, channels) {
-				channels = append(channels, item.ChannelID)
-			}
-		} else if *item.ChannelIDs != nil {
-			for _, subchannel := range *item.ChannelIDs {
-				if !stringInSlice(subchannel, channels) {
-					channels = append(channels, subchannel)
-				}
+	for i := range config.Channels {
+		for _, channelID := range getRegisteredChannels(config, i) {
+			if !stringInSlice(channelID, channels) {
+				channels = append(channels, channelID)
 			}
 		}
 	}
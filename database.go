@@ -1,108 +1,203 @@
 package main
 
 import (
-	"encoding/json"
 	"fmt"
 	"log"
+	"os"
 	"time"
 
-	"github.com/HouzuoGuo/tiedot/db"
 	"github.com/fatih/color"
 )
 
+// Storage for download records & the persistent download queue
+type downloadDatabase interface {
+	InsertDownload(download *download) error
+	FindDownloadsByURL(inputURL string) ([]*download, error)
+	FindDownloadsByHash(hash string) ([]*download, error)
+	DuplicateStats() (count int, size int64, err error)
+	DownloadCount() (int, error)
+	DownloadCountByChannel(channelID string) (int, error)
+	DownloadCountByUser(userID string) (int, error)
+	FindDownloads(filter downloadFilter) ([]*download, error)
+	ImportDownloads(downloads []*download) (int, error)
+	DeleteDownload(id int64) error
+
+	FindHistoryCheckpoint(channelID string) (*historyCheckpoint, error)
+	SaveHistoryCheckpoint(checkpoint *historyCheckpoint) error
+	DeleteHistoryCheckpoint(channelID string) error
+
+	FindLastSeenMessage(channelID string) (string, error)
+	SaveLastSeenMessage(channelID string, messageID string) error
+
+	InsertQueuedDownload(job *downloadJob) (int, error)
+	DeleteQueuedDownload(id int) error
+	FindQueuedDownloads() ([]*downloadJob, error)
+
+	Close() error
+}
+
+// Opens the database into myDB, upgrading from tiedot if an old database is found
+func openDatabase() error {
+	if err := os.MkdirAll(databasePath, 0755); err != nil {
+		return fmt.Errorf("unable to create database folder: %s", err)
+	}
+	store, err := openSqliteDatabase(databaseFilePath)
+	if err != nil {
+		return err
+	}
+	if err := migrateTiedotDatabase(store); err != nil {
+		store.Close()
+		return fmt.Errorf("unable to migrate old database: %s", err)
+	}
+	myDB = store
+	return nil
+}
+
+// Narrows down FindDownloads, zero values match everything
+type downloadFilter struct {
+	ChannelID string
+	UserID    string
+	Since     time.Time
+	Until     time.Time
+}
+
+func (filter downloadFilter) matches(record *download) bool {
+	if filter.ChannelID != "" && record.ChannelID != filter.ChannelID {
+		return false
+	}
+	if filter.UserID != "" && record.UserID != filter.UserID {
+		return false
+	}
+	if !filter.Since.IsZero() && record.Time.Before(filter.Since) {
+		return false
+	}
+	if !filter.Until.IsZero() && !record.Time.Before(filter.Until) {
+		return false
+	}
+	return true
+}
+
 // Trim files already downloaded and stored in database
-func trimDownloadedLinks(linkList map[string]string, channelID string) map[string]string {
-	newList := make(map[string]string, 0)
-	for link, filename := range linkList {
-		downloadedImages := dbFindDownloadByURL(link)
+func trimDownloadedLinks(linkList []*fileItem, channelID string) []*fileItem {
+	var newList []*fileItem
+	for _, link := range linkList {
+		downloadedImages := dbFindDownloadByURL(link.Link)
 		isMatched := false
 		for _, downloadedImage := range downloadedImages {
-			if downloadedImage.ChannelID == channelID {
+			// Indexed files may be under a destination several channels share
+			if downloadedImage.ChannelID == channelID || downloadedImage.Extractor == indexExtractorName {
 				isMatched = true
 			}
 		}
 		if isMatched == false {
-			newList[link] = filename
+			newList = append(newList, link)
 		} else {
-			log.Println(logPrefixFileSkip, color.GreenString("Found URL has already been downloaded for this channel: %s", link))
+			log.Println(logPrefixFileSkip, color.GreenString("Found URL has already been downloaded for this channel: %s", link.Link))
 		}
 	}
 	return newList
 }
 
 func dbInsertDownload(download *download) error {
-	_, err := myDB.Use("Downloads").Insert(map[string]interface{}{
-		"URL":         download.URL,
-		"Time":        download.Time.String(),
-		"Destination": download.Destination,
-		"Filename":    download.Filename,
-		"ChannelID":   download.ChannelID,
-		"UserID":      download.UserID,
-	})
-	return err
-}
-
-func dbFindDownloadByID(id int) *download {
-	downloads := myDB.Use("Downloads")
-	readBack, err := downloads.Read(id)
+	return myDB.InsertDownload(download)
+}
+
+func dbFindDownloadByURL(inputURL string) []*download {
+	downloads, err := myDB.FindDownloadsByURL(inputURL)
 	if err != nil {
 		log.Println(color.HiRedString("Failed to read database:\t%s", err))
 	}
-	timeT, _ := time.Parse("2006-01-02 15:04:05.999999999 -0700 MST", readBack["Time"].(string))
-	return &download{
-		URL:         readBack["URL"].(string),
-		Time:        timeT,
-		Destination: readBack["Destination"].(string),
-		Filename:    readBack["Filename"].(string),
-		ChannelID:   readBack["ChannelID"].(string),
-		UserID:      readBack["UserID"].(string),
-	}
+	return downloads
 }
 
-func dbFindDownloadByURL(inputURL string) []*download {
-	var query interface{}
-	json.Unmarshal([]byte(fmt.Sprintf(`[{"eq": "%s", "in": ["URL"]}]`, inputURL)), &query)
-	queryResult := make(map[int]struct{})
-	db.EvalQuery(query, myDB.Use("Downloads"), &queryResult)
+func dbFindDownloadsByHash(hash string) []*download {
+	downloads, err := myDB.FindDownloadsByHash(hash)
+	if err != nil {
+		log.Println(color.HiRedString("Failed to read database:\t%s", err))
+	}
+	return downloads
+}
 
-	downloadedImages := make([]*download, 0)
-	for id := range queryResult {
-		downloadedImages = append(downloadedImages, dbFindDownloadByID(id))
+// Files & bytes not stored again thanks to the duplicate policy
+func dbDuplicateStats() (int, int64) {
+	count, size, err := myDB.DuplicateStats()
+	if err != nil {
+		log.Println(color.HiRedString("Failed to count duplicates in database:\t%s", err))
 	}
-	return downloadedImages
+	return count, size
 }
 
 func dbDownloadCount() int {
-	i := 0
-	myDB.Use("Downloads").ForEachDoc(func(id int, docContent []byte) (willMoveOn bool) {
-		i++
-		return true
-	})
-	return i
+	count, err := myDB.DownloadCount()
+	if err != nil {
+		log.Println(color.HiRedString("Failed to count downloads in database:\t%s", err))
+	}
+	return count
 }
 
 func dbDownloadCountByChannel(channelID string) int {
-	var query interface{}
-	json.Unmarshal([]byte(fmt.Sprintf(`[{"eq": "%s", "in": ["ChannelID"]}]`, channelID)), &query)
-	queryResult := make(map[int]struct{})
-	db.EvalQuery(query, myDB.Use("Downloads"), &queryResult)
-
-	downloadedImages := make([]*download, 0)
-	for id := range queryResult {
-		downloadedImages = append(downloadedImages, dbFindDownloadByID(id))
+	count, err := myDB.DownloadCountByChannel(channelID)
+	if err != nil {
+		log.Println(color.HiRedString("Failed to count downloads in database:\t%s", err))
 	}
-	return len(downloadedImages)
+	return count
 }
 
 func dbDownloadCountByUser(userID string) int {
-	var query interface{}
-	json.Unmarshal([]byte(fmt.Sprintf(`[{"eq": "%s", "in": ["UserID"]}]`, userID)), &query)
-	queryResult := make(map[int]struct{})
-	db.EvalQuery(query, myDB.Use("Downloads"), &queryResult)
+	count, err := myDB.DownloadCountByUser(userID)
+	if err != nil {
+		log.Println(color.HiRedString("Failed to count downloads in database:\t%s", err))
+	}
+	return count
+}
+
+func dbInsertQueuedDownload(job *downloadJob) (int, error) {
+	return myDB.InsertQueuedDownload(job)
+}
+
+func dbDeleteQueuedDownload(id int) error {
+	return myDB.DeleteQueuedDownload(id)
+}
+
+func dbFindQueuedDownloads() []*downloadJob {
+	jobs, err := myDB.FindQueuedDownloads()
+	if err != nil {
+		log.Println(color.HiRedString("Failed to read download queue from database:\t%s", err))
+	}
+	return jobs
+}
+
+func dbFindHistoryCheckpoint(channelID string) *historyCheckpoint {
+	checkpoint, err := myDB.FindHistoryCheckpoint(channelID)
+	if err != nil {
+		log.Println(color.HiRedString("Failed to read history checkpoint from database:\t%s", err))
+	}
+	return checkpoint
+}
+
+func dbSaveHistoryCheckpoint(checkpoint *historyCheckpoint) {
+	checkpoint.Updated = time.Now()
+	if err := myDB.SaveHistoryCheckpoint(checkpoint); err != nil {
+		log.Println(color.HiRedString("Failed to save history checkpoint to database:\t%s", err))
+	}
+}
+
+func dbDeleteHistoryCheckpoint(channelID string) {
+	if err := myDB.DeleteHistoryCheckpoint(channelID); err != nil {
+		log.Println(color.HiRedString("Failed to delete history checkpoint from database:\t%s", err))
+	}
+}
+
+func dbFindLastSeenMessage(channelID string) string {
+	messageID, err := myDB.FindLastSeenMessage(channelID)
+	if err != nil {
+		log.Println(color.HiRedString("Failed to read last seen message from database:\t%s", err))
+	}
+	return messageID
+}
 
-	downloadedImages := make([]*download, 0)
-	for id := range queryResult {
-		downloadedImages = append(downloadedImages, dbFindDownloadByID(id))
+func dbSaveLastSeenMessage(channelID string, messageID string) {
+	if err := myDB.SaveLastSeenMessage(channelID, messageID); err != nil {
+		log.Println(color.HiRedString("Failed to save last seen message to database:\t%s", err))
 	}
-	return len(downloadedImages)
 }
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/fatih/color"
+)
+
+const (
+	duplicatePolicySave     = "save"
+	duplicatePolicySkip     = "skip"
+	duplicatePolicyHardlink = "hardlink"
+	duplicatePolicySymlink  = "symlink"
+)
+
+func getDuplicatePolicy(channelConfig configurationChannel) string {
+	if channelConfig.DuplicatePolicy != nil {
+		switch *channelConfig.DuplicatePolicy {
+		case duplicatePolicySkip, duplicatePolicyHardlink, duplicatePolicySymlink:
+			return *channelConfig.DuplicatePolicy
+		}
+	}
+	return duplicatePolicySave
+}
+
+// Finds an earlier download of the same content that's still on disk
+func findOriginalDownload(record *download) *download {
+	if record.Hash == "" {
+		return nil
+	}
+	for _, candidate := range dbFindDownloadsByHash(record.Hash) {
+		if candidate.Destination == record.Destination {
+			continue
+		}
+		if info, err := os.Lstat(candidate.Destination); err == nil && info.Mode().IsRegular() {
+			return candidate
+		}
+	}
+	return nil
+}
+
+// Replaces the freshly saved file at record.Destination according to the channel's duplicate policy,
+// the record is updated with the relation to the original download
+func applyDuplicatePolicy(record *download, channelConfig configurationChannel) {
+	original := findOriginalDownload(record)
+	if original == nil {
+		return
+	}
+	policy := getDuplicatePolicy(channelConfig)
+	// Indexed files are the archive being added to, another copy of one is only kept if asked for
+	if original.Extractor == indexExtractorName && channelConfig.DuplicatePolicy == nil {
+		policy = duplicatePolicySkip
+	}
+	record.DuplicateOf = original.ID
+	if original.DuplicateOf != 0 {
+		record.DuplicateOf = original.DuplicateOf
+	}
+	record.DuplicatePolicy = policy
+
+	switch policy {
+	case duplicatePolicySkip:
+		os.Remove(record.Destination)
+		record.Destination = original.Destination
+	case duplicatePolicyHardlink, duplicatePolicySymlink:
+		err := replaceWithLink(original.Destination, record.Destination, policy == duplicatePolicySymlink)
+		if err != nil {
+			log.Println(color.HiRedString("[applyDuplicatePolicy] Could not %s \"%s\" to \"%s\", keeping the copy: %s",
+				policy, record.Destination, original.Destination, err))
+			record.DuplicatePolicy = duplicatePolicySave
+		}
+	}
+}
+
+// Swaps the file for a link in one step so a failure leaves the copy in place
+func replaceWithLink(target string, path string, symlink bool) error {
+	tmpPath := path + ".link"
+	os.Remove(tmpPath)
+	var err error
+	if symlink {
+		var absoluteTarget string
+		absoluteTarget, err = filepath.Abs(target)
+		if err == nil {
+			err = os.Symlink(absoluteTarget, tmpPath)
+		}
+	} else {
+		err = os.Link(target, tmpPath)
+	}
+	if err != nil {
+		return err
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	return nil
+}
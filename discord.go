@@ -1,17 +1,25 @@
 package main
 
 import (
+	"bytes"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"log"
+	"net/http"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/AvraamMavridis/randomcolor"
 	"github.com/bwmarrin/discordgo"
+	"github.com/fatih/color"
+	"github.com/gorilla/websocket"
 	"github.com/hako/durafmt"
 )
 
 func presenceKeyReplacement(input string) string {
+	config := getConfig()
 	//TODO: Case-insensitive key replacement.
 	if strings.Contains(input, "{{") && strings.Contains(input, "}}") {
 		countInt := int64(dbDownloadCount()) + *config.InflateCount
@@ -55,6 +63,7 @@ func presenceKeyReplacement(input string) string {
 }
 
 func updateDiscordPresence() {
+	config := getConfig()
 	if config.PresenceEnabled {
 		// Vars
 		countInt := int64(dbDownloadCount()) + *config.InflateCount
@@ -92,18 +101,19 @@ func updateDiscordPresence() {
 
 		// Update
 		bot.UpdateStatusComplex(discordgo.UpdateStatusData{
-			Game: &discordgo.Game{
+			Activities: []*discordgo.Activity{{
 				Name:    status,
 				Type:    config.PresenceType,
 				Details: statusDetails, // Only visible if real user
 				State:   statusState,   // Only visible if real user
-			},
+			}},
 			Status: config.PresenceStatus,
 		})
 	}
 }
 
 func getEmbedColor(channelID string) int {
+	config := getConfig()
 	var color *string
 	// Assign Defined Color
 	if config.EmbedColor != nil {
@@ -125,7 +135,7 @@ func getEmbedColor(channelID string) int {
 	if color != nil {
 		// Defined as Role, fetch role color
 		if *color == "role" || *color == "user" {
-			botColor := bot.State.UserColor(user.ID, channelID)
+			botColor := bot.State.UserColor(getBotUser().ID, channelID)
 			if botColor != 0 {
 				return botColor
 			}
@@ -153,8 +163,8 @@ func getEmbedColor(channelID string) int {
 	}
 
 	// User color
-	if bot.State.UserColor(user.ID, channelID) != 0 {
-		return bot.State.UserColor(user.ID, channelID)
+	if userColor := bot.State.UserColor(getBotUser().ID, channelID); userColor != 0 {
+		return userColor
 	}
 
 	// Random color
@@ -192,15 +202,17 @@ func replyEmbed(m *discordgo.Message, title string, description string) (*discor
 
 // Checks if message author is a specified bot admin.
 func isBotAdmin(m *discordgo.Message) bool {
-	return m.Author.ID == user.ID || stringInSlice(m.Author.ID, config.Admins)
+	config := getConfig()
+	return m.Author.ID == getBotUser().ID || stringInSlice(m.Author.ID, config.Admins)
 }
 
 // Checks if message author is a specified bot admin OR is server admin OR has message management perms in channel
 func isLocalAdmin(m *discordgo.Message) bool {
+	config := getConfig()
 	guild, _ := bot.State.Guild(m.GuildID)
 	localPerms, _ := bot.State.UserChannelPermissions(m.Author.ID, m.ChannelID)
 
-	botSelf := m.Author.ID == user.ID
+	botSelf := m.Author.ID == getBotUser().ID
 	botAdmin := stringInSlice(m.Author.ID, config.Admins)
 	guildOwner := m.Author.ID == guild.OwnerID
 	guildAdmin := localPerms&discordgo.PermissionAdministrator > 0
@@ -209,6 +221,101 @@ func isLocalAdmin(m *discordgo.Message) bool {
 	return botSelf || botAdmin || guildOwner || guildAdmin || localManageMessages
 }
 
+// Token for the Discord session from credentials, bot tokens are prefixed
+func getDiscordToken() (string, error) {
+	config := getConfig()
+	if config.Credentials.Token != "" && config.Credentials.Token != placeholderToken {
+		log.Println(color.GreenString("Connecting to Discord via Token..."))
+		return "Bot " + config.Credentials.Token, nil
+	} else if (config.Credentials.Email != "" && config.Credentials.Email != placeholderEmail) &&
+		(config.Credentials.Password != "" && config.Credentials.Password != placeholderPassword) {
+		log.Println(color.GreenString("Connecting to Discord via Login..."))
+		return getLoginToken(config.Credentials.Email, config.Credentials.Password)
+	}
+	return "", fmt.Errorf("no valid credentials for Discord")
+}
+
+func fetchBotUser() error {
+	user, err := bot.User("@me")
+	if err != nil {
+		log.Println(color.HiRedString("Error obtaining bot user details: %s", err))
+		return err
+	}
+	botUser.Store(user)
+	log.Println(color.HiGreenString("Discord logged into %s", getUserIdentifier(*user)))
+	return nil
+}
+
+// The account the bot is logged in as, replaced when reconnecting with other credentials
+func getBotUser() *discordgo.User {
+	return botUser.Load()
+}
+
+// Discord closes the connection with this code when the bot asks for a privileged intent it wasn't given
+const discordDisallowedIntentsCode = 4014
+
+// Message content is needed to find links, it's a privileged intent that has to be enabled for bots in the Discord Developer Portal
+func getDiscordIntents() discordgo.Intent {
+	intents := discordgo.IntentsAllWithoutPrivileged
+	if getConfig().MessageContentIntent {
+		intents |= discordgo.IntentMessageContent
+	}
+	return intents
+}
+
+// Says what to do when Discord refuses the message content intent, other errors are returned as they are
+func describeDiscordOpenError(err error) error {
+	var closeError *websocket.CloseError
+	if errors.As(err, &closeError) && closeError.Code == discordDisallowedIntentsCode {
+		return fmt.Errorf("%s -- enable the Message Content Intent for the bot in the Discord Developer Portal, "+
+			"or set messageContentIntent to false to only see messages that mention the bot", err)
+	}
+	return err
+}
+
+// Starts a new session with the current credentials, the bot stays offline if they don't work
+func reconnectDiscord() error {
+	token, err := getDiscordToken()
+	if err != nil {
+		return err
+	}
+	bot.Close()
+	bot.Token = token
+	bot.Identify.Intents = getDiscordIntents()
+	if err := bot.Open(); err != nil {
+		return describeDiscordOpenError(err)
+	}
+	return fetchBotUser()
+}
+
+// discordgo no longer logs in with email & password, this requests a token the way it used to
+func getLoginToken(email string, password string) (string, error) {
+	body, err := json.Marshal(map[string]string{"login": email, "password": password})
+	if err != nil {
+		return "", err
+	}
+	response, err := http.Post(discordgo.EndpointAPI+"auth/login", "application/json", bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	defer response.Body.Close()
+
+	var result struct {
+		Token string `json:"token"`
+		MFA   bool   `json:"mfa"`
+	}
+	if err := json.NewDecoder(response.Body).Decode(&result); err != nil {
+		return "", fmt.Errorf("unexpected login response (HTTP %d)", response.StatusCode)
+	}
+	if result.Token == "" {
+		if result.MFA {
+			return "", fmt.Errorf("account uses two-factor authentication, use a token instead")
+		}
+		return "", fmt.Errorf("unable to fetch discord authentication token (HTTP %d)", response.StatusCode)
+	}
+	return result.Token, nil
+}
+
 func getUserIdentifier(usr discordgo.User) string {
 	return fmt.Sprintf("\"%s\"#%s", usr.Username, usr.Discriminator)
 }
@@ -231,9 +338,22 @@ func getChannelName(channelID string) string {
 	return sourceChannelName
 }
 
-// For command case-insensitivity
-func messageToLower(message *discordgo.Message) *discordgo.Message {
+// For command case-insensitivity, only the prefix & command name are lowercased so arguments like paths keep their case
+func commandToLower(message *discordgo.Message, prefix string) *discordgo.Message {
 	newMessage := *message
-	newMessage.Content = strings.ToLower(newMessage.Content)
+	content := message.Content
+	start := 0
+	if prefix != "" && len(content) >= len(prefix) && strings.EqualFold(content[:len(prefix)], prefix) {
+		start = len(prefix)
+	} else if strings.HasPrefix(content, "<@") {
+		if i := strings.Index(content, "> "); i != -1 {
+			start = i + len("> ")
+		}
+	}
+	end := len(content)
+	if i := strings.IndexByte(content[start:], ' '); i != -1 {
+		end = start + i
+	}
+	newMessage.Content = strings.ToLower(content[:end]) + content[end:]
 	return &newMessage
 }
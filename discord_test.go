@@ -0,0 +1,26 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+func TestCommandToLower(t *testing.T) {
+	tests := []struct {
+		content string
+		want    string
+	}{
+		{"DDG Import Database/Exports/Downloads.jsonl", "ddg import Database/Exports/Downloads.jsonl"},
+		{"ddg INDEX D:/Archive links:Links.txt", "ddg index D:/Archive links:Links.txt"},
+		{"ddg Status", "ddg status"},
+		{"<@123> Import Backup.jsonl", "<@123> import Backup.jsonl"},
+		{"Just Chatting", "just Chatting"}, // not a command, the router ignores it either way
+		{"", ""},
+	}
+	for _, test := range tests {
+		if got := commandToLower(&discordgo.Message{Content: test.content}, "ddg "); got.Content != test.want {
+			t.Errorf("commandToLower(%q) = %q, want %q", test.content, got.Content, test.want)
+		}
+	}
+}
@@ -2,9 +2,12 @@ package main
 
 import (
 	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"image"
-	"io/ioutil"
+	"io"
 	"log"
 	"math/rand"
 	"mime"
@@ -15,6 +18,7 @@ import (
 	"sort"
 	"strconv"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/bwmarrin/discordgo"
@@ -25,12 +29,24 @@ import (
 )
 
 type download struct {
-	URL         string
+	ID          int64
+	URL         string // resolved link the file was downloaded from
+	SourceURL   string // link as posted, before extractors
 	Time        time.Time
 	Destination string
 	Filename    string
 	ChannelID   string
 	UserID      string
+	MessageID   string
+	GuildID     string
+	Size        int64
+	ContentType string // detected MIME type
+	Hash        string // SHA-256, hex
+	Extractor   string
+	Duration    time.Duration
+	// Set when the same content was already downloaded
+	DuplicateOf     int64
+	DuplicatePolicy string
 }
 
 type downloadStatus int
@@ -53,11 +69,21 @@ const (
 	downloadFailedCreatingSubfolder   downloadStatus = 11
 	downloadFailedWritingFile         downloadStatus = 12
 	downloadFailedWritingDatabase     downloadStatus = 13
+	downloadFailedStatusCode          downloadStatus = 14
+	downloadFailedStatusCodePermanent downloadStatus = 15
+	downloadFailedPlaceholder         downloadStatus = 16
+	downloadFailedExternal            downloadStatus = 17
+	downloadFailedExternalPermanent   downloadStatus = 18
+
+	downloadSkippedQueueStopped   downloadStatus = 19 // still queued in the database for the next run
+	downloadFailedExternalPartial downloadStatus = 20 // some files saved, running it again would save them twice
 )
 
 type downloadStatusStruct struct {
-	Status downloadStatus
-	Error  error
+	Status     downloadStatus
+	Error      error
+	StatusCode int
+	RetryAfter time.Duration
 }
 
 func mDownloadStatus(status downloadStatus, _error ...error) downloadStatusStruct {
@@ -105,10 +131,65 @@ func getDownloadStatusString(status downloadStatus) string {
 		return "Download Failed - Error Writing File"
 	case downloadFailedWritingDatabase:
 		return "Download Failed - Error Writing to Database"
+	case downloadFailedStatusCode:
+		return "Download Failed - Unsuccessful HTTP Status"
+	case downloadFailedStatusCodePermanent:
+		return "Download Failed - Unsuccessful HTTP Status (Permanent)"
+	case downloadFailedPlaceholder:
+		return "Download Failed - Content Removed (Placeholder Image)"
+	case downloadFailedExternal:
+		return "Download Failed - External Downloader"
+	case downloadFailedExternalPermanent:
+		return "Download Failed - External Downloader (Permanent)"
+	//
+	case downloadSkippedQueueStopped:
+		return "Download Skipped - Queue Stopped, Kept for Next Run"
+	case downloadFailedExternalPartial:
+		return "Download Failed - External Downloader (Only Some Files Saved)"
 	}
 	return "Unknown Error"
 }
 
+// Permanent failures won't succeed by trying again
+func isPermanentDownloadFailure(status downloadStatus) bool {
+	return status == downloadFailedStatusCodePermanent || status == downloadFailedPlaceholder ||
+		status == downloadFailedExternalPermanent || status == downloadFailedExternalPartial
+}
+
+// Client errors are permanent, aside from those caused by timing or rate limits
+func getHTTPStatusFailure(statusCode int) downloadStatus {
+	if statusCode >= 400 && statusCode < 500 &&
+		statusCode != http.StatusRequestTimeout &&
+		statusCode != http.StatusTooEarly &&
+		statusCode != http.StatusTooManyRequests {
+		return downloadFailedStatusCodePermanent
+	}
+	return downloadFailedStatusCode
+}
+
+// Hosts that redirect removed content to a placeholder image rather than returning an error
+func isPlaceholderURL(link *url.URL) bool {
+	host := strings.ToLower(link.Hostname())
+	return (host == "i.imgur.com" || host == "imgur.com") && link.Path == "/removed.png"
+}
+
+func isPlaceholderHash(hash string) bool {
+	config := getConfig()
+	return stringInSlice(hash, config.PlaceholderHashes)
+}
+
+// Matches the hostname against the channel's DomainBlacklist
+func isDomainBlacklisted(channelConfig configurationChannel, link string) bool {
+	if channelConfig.DomainBlacklist == nil {
+		return false
+	}
+	u, err := url.Parse(link)
+	if err != nil {
+		return false
+	}
+	return stringInSlice(u.Hostname(), *channelConfig.DomainBlacklist)
+}
+
 func isDiscordEmoji(link string) bool {
 	// always match discord emoji URLs, eg https://cdn.discordapp.com/emojis/340989430460317707.png
 	if strings.HasPrefix(link, "https://cdn.discordapp.com/emojis/") {
@@ -188,146 +269,35 @@ func getRawLinks(m *discordgo.Message) []*fileItem {
 	return links
 }
 
-func getDownloadLinks(inputURL string, channelID string) map[string]string {
-	logPrefixErrorHere := color.HiRedString("[getDownloadLinks]")
+func getDownloadLinks(inputURL string, channelID string) []*fileItem {
+	config := getConfig()
+	channelConfig := getChannelConfig(channelID)
 
 	/* TODO: Download Support...
 	- TikTok: Tried, once the connection is closed the cdn URL is rendered invalid
 	- Facebook Photos: Tried, it doesn't preload image data, it's loaded in after. Would have to keep connection open, find alternative way to grab, or use api.
 	*/
 
-	if regexUrlTwitter.MatchString(inputURL) {
-		links, err := getTwitterUrls(inputURL)
-		if err != nil {
-			log.Println(logPrefixErrorHere, color.RedString("Twitter Media fetch failed for %s -- %s", inputURL, err))
-		} else if len(links) > 0 {
-			return trimDownloadedLinks(links, channelID)
-		}
-	}
-	if regexUrlTwitterStatus.MatchString(inputURL) {
-		links, err := getTwitterStatusUrls(inputURL, channelID)
-		if err != nil {
-			log.Println(logPrefixErrorHere, color.RedString("Twitter Status fetch failed for %s -- %s", inputURL, err))
-		} else if len(links) > 0 {
-			return trimDownloadedLinks(links, channelID)
-		}
-	}
-
-	if regexUrlInstagram.MatchString(inputURL) {
-		links, err := getInstagramUrls(inputURL)
-		if err != nil {
-			log.Println(logPrefixErrorHere, color.RedString("Instagram fetch failed for %s -- %s", inputURL, err))
-		} else if len(links) > 0 {
-			return trimDownloadedLinks(links, channelID)
-		}
-	}
-
-	if regexUrlFacebookVideo.MatchString(inputURL) || regexUrlFacebookVideoWatch.MatchString(inputURL) {
-		links, err := getFacebookVideoUrls(inputURL)
-		if err != nil {
-			log.Println(logPrefixErrorHere, color.RedString("Facebook Video fetch failed for %s -- %s", inputURL, err))
-		} else if len(links) > 0 {
-			return trimDownloadedLinks(links, channelID)
-		}
-	}
-
-	if regexUrlImgurSingle.MatchString(inputURL) {
-		links, err := getImgurSingleUrls(inputURL)
-		if err != nil {
-			log.Println(logPrefixErrorHere, color.RedString("Imgur Media fetch failed for %s -- %s", inputURL, err))
-		} else if len(links) > 0 {
-			return trimDownloadedLinks(links, channelID)
-		}
-	}
-	if regexUrlImgurAlbum.MatchString(inputURL) {
-		links, err := getImgurAlbumUrls(inputURL)
-		if err != nil {
-			log.Println(logPrefixErrorHere, color.RedString("Imgur Album fetch failed for %s -- %s", inputURL, err))
-		} else if len(links) > 0 {
-			return trimDownloadedLinks(links, channelID)
-		}
-	}
-
-	if regexUrlStreamable.MatchString(inputURL) {
-		links, err := getStreamableUrls(inputURL)
-		if err != nil {
-			log.Println(logPrefixErrorHere, color.RedString("Streamable fetch failed for %s -- %s", inputURL, err))
-		} else if len(links) > 0 {
-			return trimDownloadedLinks(links, channelID)
-		}
-	}
-
-	if regexUrlGfycat.MatchString(inputURL) {
-		links, err := getGfycatUrls(inputURL)
-		if err != nil {
-			log.Println(logPrefixErrorHere, color.RedString("Gfycat fetch failed for %s -- %s", inputURL, err))
-		} else if len(links) > 0 {
-			return trimDownloadedLinks(links, channelID)
-		}
-	}
-
-	if regexUrlFlickrPhoto.MatchString(inputURL) {
-		links, err := getFlickrPhotoUrls(inputURL)
-		if err != nil {
-			log.Println(logPrefixErrorHere, color.RedString("Flickr Photo fetch failed for %s -- %s", inputURL, err))
-		} else if len(links) > 0 {
-			return trimDownloadedLinks(links, channelID)
-		}
-	}
-	if regexUrlFlickrAlbum.MatchString(inputURL) {
-		links, err := getFlickrAlbumUrls(inputURL)
-		if err != nil {
-			log.Println(logPrefixErrorHere, color.RedString("Flickr Album fetch failed for %s -- %s", inputURL, err))
-		} else if len(links) > 0 {
-			return trimDownloadedLinks(links, channelID)
-		}
-	}
-	if regexUrlFlickrAlbumShort.MatchString(inputURL) {
-		links, err := getFlickrAlbumShortUrls(inputURL)
-		if err != nil {
-			log.Println(logPrefixErrorHere, color.RedString("Flickr Album (short) fetch failed for %s -- %s", inputURL, err))
-		} else if len(links) > 0 {
-			return trimDownloadedLinks(links, channelID)
-		}
-	}
-	if regexUrlGoogleDrive.MatchString(inputURL) {
-		links, err := getGoogleDriveUrls(inputURL)
-		if err != nil {
-			log.Println(logPrefixErrorHere, color.RedString("Google Drive Album URL for %s -- %s", inputURL, err))
-		} else if len(links) > 0 {
-			return trimDownloadedLinks(links, channelID)
-		}
-	}
-	if regexUrlGoogleDriveFolder.MatchString(inputURL) {
-		links, err := getGoogleDriveFolderUrls(inputURL)
-		if err != nil {
-			log.Println(logPrefixErrorHere, color.RedString("Google Drive Folder URL for %s -- %s", inputURL, err))
-		} else if len(links) > 0 {
-			return trimDownloadedLinks(links, channelID)
-		}
-	}
-	if regexUrlTistory.MatchString(inputURL) {
-		links, err := getTistoryUrls(inputURL)
-		if err != nil {
-			log.Println(logPrefixErrorHere, color.RedString("Tistory URL failed for %s -- %s", inputURL, err))
-		} else if len(links) > 0 {
-			return trimDownloadedLinks(links, channelID)
-		}
-	}
-	if regexUrlTistoryLegacy.MatchString(inputURL) {
-		links, err := getLegacyTistoryUrls(inputURL)
-		if err != nil {
-			log.Println(logPrefixErrorHere, color.RedString("Legacy Tistory URL failed for %s -- %s", inputURL, err))
-		} else if len(links) > 0 {
-			return trimDownloadedLinks(links, channelID)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(config.DownloadTimeout)*time.Second)
+	defer cancel()
+	for _, registered := range extractorRegistry {
+		name := registered.extractor.Name()
+		if !registered.extractor.Match(inputURL) || !isExtractorEnabled(channelConfig, name, registered.enabledByDefault) {
+			continue
 		}
-	}
-	// The original project has this as an option,
-	if regexUrlPossibleTistorySite.MatchString(inputURL) {
-		links, err := getPossibleTistorySiteUrls(inputURL)
+		links, err := registered.extractor.Extract(ctx, inputURL, channelID)
 		if err != nil {
-			log.Println(logPrefixErrorHere, color.RedString("Checking for Tistory site failed for %s -- %s", inputURL, err))
+			log.Println(color.HiRedString("[extractor:%s]", name), color.RedString("%s", &extractorError{
+				Extractor: name,
+				Link:      inputURL,
+				Err:       err,
+			}))
 		} else if len(links) > 0 {
+			for _, link := range links {
+				if link.Extractor == "" {
+					link.Extractor = name
+				}
+			}
 			return trimDownloadedLinks(links, channelID)
 		}
 	}
@@ -347,14 +317,14 @@ func getDownloadLinks(inputURL string, channelID string) map[string]string {
 		}
 	}
 
-	return trimDownloadedLinks(map[string]string{inputURL: ""}, channelID)
+	return trimDownloadedLinks([]*fileItem{{Link: inputURL}}, channelID)
 }
 
 func getFileLinks(m *discordgo.Message) []*fileItem {
 	var fileItems []*fileItem
 
-	linkTime, err := m.Timestamp.Parse()
-	if err != nil {
+	linkTime := m.Timestamp
+	if linkTime.IsZero() {
 		linkTime = time.Now()
 	}
 
@@ -364,45 +334,64 @@ func getFileLinks(m *discordgo.Message) []*fileItem {
 			rawLink.Link,
 			m.ChannelID,
 		)
-		for link, filename := range downloadLinks {
+		for _, downloadLink := range downloadLinks {
+			filename := downloadLink.Filename
 			if rawLink.Filename != "" {
 				filename = rawLink.Filename
 			}
 
 			fileItems = append(fileItems, &fileItem{
-				Link:     link,
-				Filename: filename,
-				Time:     linkTime,
+				Link:       downloadLink.Link,
+				SourceLink: rawLink.Link,
+				Filename:   filename,
+				Time:       linkTime,
+				Extractor:  downloadLink.Extractor,
+				AudioLink:  downloadLink.AudioLink,
+				External:   downloadLink.External,
 			})
 		}
 	}
 
 	fileItems = trimDuplicateLinks(fileItems)
+	for i, item := range fileItems {
+		item.Index = i + 1
+	}
 
 	return fileItems
 }
 
-func startDownload(inputURL string, filename string, path string, message *discordgo.Message, fileTime time.Time, historyCmd bool) downloadStatusStruct {
+func startDownload(file *fileItem, path string, message *discordgo.Message, historyCmd bool) downloadStatusStruct {
+	config := getConfig()
+	inputURL := file.Link
 	status := mDownloadStatus(downloadFailed)
 	logPrefixErrorHere := color.HiRedString("[startDownload]")
 
+	attempts := 0
 	for i := 0; i < config.DownloadRetryMax; i++ {
-		status = tryDownload(inputURL, filename, path, message, fileTime, historyCmd)
-		if status.Status < downloadFailed { // Success or Skip
+		attempts++
+		status = tryDownload(file, path, message, historyCmd)
+		if status.Status < downloadFailed || isPermanentDownloadFailure(status.Status) { // Success, Skip or no point retrying
 			break
-		} else {
-			time.Sleep(5 * time.Second)
+		} else if i+1 < config.DownloadRetryMax {
+			delay := getDownloadBackoff(inputURL, i, status.RetryAfter)
+			if config.DebugOutput {
+				log.Println(logPrefixDebug, color.YellowString("Retrying %s in %s...", inputURL, durafmt.ParseShort(delay).String()))
+			}
+			time.Sleep(delay)
 		}
 	}
 
 	if status.Status >= downloadFailed { // Any kind of failure
-		log.Println(logPrefixErrorHere, color.RedString("Gave up on downloading %s", inputURL))
+		log.Println(logPrefixErrorHere, color.RedString("Gave up on downloading %s after %d attempt(s)", inputURL, attempts))
 		if isChannelRegistered(message.ChannelID) {
 			channelConfig := getChannelConfig(message.ChannelID)
 			if !historyCmd && *channelConfig.ErrorMessages {
 				content := fmt.Sprintf(
 					"Gave up trying to download\n<%s>\nafter %d failed attempts...\n\n``%s``",
-					inputURL, config.DownloadRetryMax, getDownloadStatusString(status.Status))
+					inputURL, attempts, getDownloadStatusString(status.Status))
+				if status.StatusCode != 0 {
+					content = content + fmt.Sprintf("\n``HTTP %d %s``", status.StatusCode, http.StatusText(status.StatusCode))
+				}
 				if status.Error != nil {
 					content = content + fmt.Sprintf("\n```ERROR: %s```", status.Error)
 				}
@@ -421,9 +410,17 @@ func startDownload(inputURL string, filename string, path string, message *disco
 	return status
 }
 
-func tryDownload(inputURL string, filename string, path string, message *discordgo.Message, fileTime time.Time, historyCmd bool) downloadStatusStruct {
-	cachedDownloadID++
-	thisDownloadID := cachedDownloadID
+func tryDownload(file *fileItem, path string, message *discordgo.Message, historyCmd bool) downloadStatusStruct {
+	config := getConfig()
+	inputURL := file.Link
+	filename := file.Filename
+	if file.External {
+		if !isChannelRegistered(message.ChannelID) {
+			return mDownloadStatus(downloadFailed)
+		}
+		return tryExternalDownload(file, path, message, historyCmd)
+	}
+	thisDownloadID := int(atomic.AddInt64(&cachedDownloadID, 1))
 
 	startTime := time.Now()
 
@@ -455,13 +452,69 @@ func tryDownload(inputURL string, filename string, path string, message *discord
 			return mDownloadStatus(downloadFailedRequesting, err)
 		}
 		request.Header.Add("Accept-Encoding", "identity")
+		partial := getPartialDownload(inputURL, message.ChannelID)
+		if partial != nil {
+			partial.setRangeHeaders(request)
+		}
+		waitForDomain(inputURL)
 		response, err := client.Do(request)
 		if err != nil {
 			log.Println(logPrefixErrorHere, color.HiRedString("Error while receiving response from \"%s\": %s", inputURL, err))
 			return mDownloadStatus(downloadFailedDownloadingResponse, err)
 		}
+
+		// Pick up a partial download from a previous attempt
+		if partial != nil {
+			if partial.isResumableResponse(response) {
+				defer response.Body.Close()
+				return resumePartialDownload(partial, file, response, message, historyCmd, thisDownloadID, startTime)
+			}
+			log.Println(color.YellowString("Server did not resume partial download of %s, downloading in full...", inputURL))
+			removePartialDownload(partial)
+
+			// The reply was to the ranged request, ask again for the whole file
+			response.Body.Close()
+			request.Header.Del("Range")
+			request.Header.Del("If-Range")
+			waitForDomain(inputURL)
+			response, err = client.Do(request)
+			if err != nil {
+				log.Println(logPrefixErrorHere, color.HiRedString("Error while receiving response from \"%s\": %s", inputURL, err))
+				return mDownloadStatus(downloadFailedDownloadingResponse, err)
+			}
+		}
 		defer response.Body.Close()
 
+		// Check status
+		if response.StatusCode < 200 || response.StatusCode > 299 {
+			retryAfter := parseRetryAfter(response.Header)
+			if retryAfter > 0 {
+				_, max := getDownloadBackoffLimits(inputURL)
+				retryAfter = clampRetryAfter(retryAfter, max)
+				blockDomain(inputURL, retryAfter)
+			}
+			log.Println(logPrefixErrorHere, color.HiRedString("Unsuccessful response from \"%s\": %s", inputURL, response.Status))
+			return downloadStatusStruct{
+				Status:     getHTTPStatusFailure(response.StatusCode),
+				Error:      fmt.Errorf("HTTP %s", response.Status),
+				StatusCode: response.StatusCode,
+				RetryAfter: retryAfter,
+			}
+		}
+
+		// Check for removed content placeholders
+		if isPlaceholderURL(response.Request.URL) {
+			log.Println(logPrefixErrorHere, color.HiRedString("\"%s\" redirected to a removed content placeholder", inputURL))
+			return downloadStatusStruct{
+				Status:     downloadFailedPlaceholder,
+				StatusCode: response.StatusCode,
+			}
+		}
+
+		// Date used for naming & file metadata
+		lastModified, _ := http.ParseTime(response.Header.Get("Last-Modified"))
+		fileTime := getFileDate(channelConfig, file.Time, lastModified)
+
 		// Download duration
 		if config.DebugOutput {
 			log.Println(logPrefixDebug, color.YellowString("#%d - %s to download.", thisDownloadID, durafmt.ParseShort(time.Since(startTime)).String()))
@@ -487,14 +540,17 @@ func tryDownload(inputURL string, filename string, path string, message *discord
 			}
 		}
 
-		// Read
-		bodyOfResp, err := ioutil.ReadAll(response.Body)
-		if err != nil {
+		// Sniff content type from the first 512 bytes, rest of the body is streamed
+		head := make([]byte, 512)
+		headLength, err := io.ReadFull(response.Body, head)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
 			log.Println(logPrefixErrorHere, color.HiRedString("Could not read response from \"%s\": %s", inputURL, err))
 			return mDownloadStatus(downloadFailedReadResponse, err)
 		}
+		head = head[:headLength]
+		body := io.MultiReader(bytes.NewReader(head), response.Body)
 
-		contentType := http.DetectContentType(bodyOfResp)
+		contentType := http.DetectContentType(head)
 		contentTypeParts := strings.Split(contentType, "/")
 		contentTypeFound := contentTypeParts[0]
 
@@ -518,292 +574,460 @@ func tryDownload(inputURL string, filename string, path string, message *discord
 			}
 		}
 
-		// Check content type
-		if !((*channelConfig.SaveImages && contentTypeFound == "image") ||
-			(*channelConfig.SaveVideos && contentTypeFound == "video") ||
-			(*channelConfig.SaveAudioFiles && contentTypeFound == "audio") ||
-			(*channelConfig.SaveTextFiles && contentTypeFound == "text") ||
-			(*channelConfig.SaveOtherFiles && contentTypeFound == "application")) {
-			log.Println(logPrefixFileSkip, color.GreenString("Unpermitted filetype (%s) found at %s", contentTypeFound, inputURL))
-			return mDownloadStatus(downloadSkippedUnpermittedType)
-		}
-
-		// Check extension
+		// Check content type & extension
 		extension := strings.ToLower(filepath.Ext(filename))
-		if stringInSlice(extension, *channelConfig.ExtensionBlacklist) || stringInSlice(extension, []string{".com", ".net", ".org"}) {
-			log.Println(logPrefixFileSkip, color.GreenString("Unpermitted extension (%s) found at %s", extension, inputURL))
-			return mDownloadStatus(downloadSkippedUnpermittedExtension)
+		if status := checkFileAllowed(channelConfig, inputURL, extension, contentTypeFound); status != nil {
+			return *status
 		}
 
-		// Duplicate Image Filter
+		// Duplicate Image Filter, the image is only added to it once saved
+		var imageHash *duplo.Hash
 		if config.FilterDuplicateImages && contentTypeFound == "image" && extension != ".gif" && extension != ".webp" {
-			img, _, err := image.Decode(bytes.NewReader(bodyOfResp))
-			if err != nil {
-				log.Println(color.HiRedString("Error converting buffer to image for hashing:\t%s", err))
-			} else {
-				hash, _ := duplo.CreateHash(img)
-				matches := imgStore.Query(hash)
-				sort.Sort(matches)
-				for _, match := range matches {
-					/*if config.DebugOutput {
-						log.Println(color.YellowString("Similarity Score: %f", match.Score))
-					}*/
-					if match.Score < config.FilterDuplicateImagesThreshold {
-						log.Println(logPrefixFileSkip, color.GreenString("Duplicate detected (Score of %f) found at %s", match.Score, inputURL))
-						return mDownloadStatus(downloadSkippedDetectedDuplicate)
-					}
+			// Only images under the size cap are buffered for hashing, anything else is streamed as is
+			maxSize := config.FilterDuplicateImagesMaxSize * 1024 * 1024
+			if response.ContentLength <= maxSize {
+				buffer := new(bytes.Buffer)
+				_, err := io.CopyN(buffer, body, maxSize+1)
+				if err != nil && err != io.EOF {
+					log.Println(logPrefixErrorHere, color.HiRedString("Could not read response from \"%s\": %s", inputURL, err))
+					return mDownloadStatus(downloadFailedReadResponse, err)
 				}
-				imgStore.Add(cachedDownloadID, hash)
-			}
-		}
-
-		// Names
-		sourceChannelName := message.ChannelID
-		sourceGuildName := "Unavailable"
-		sourceChannel, err := bot.State.Channel(message.ChannelID)
-		if err != nil {
-			log.Println(logPrefixErrorHere, color.HiRedString("Error fetching channel state for %s: %s", message.ChannelID, err))
-		}
-		if sourceChannel != nil && sourceChannel.Name != "" {
-			sourceChannelName = sourceChannel.Name
-			if sourceChannel.GuildID != "" {
-				sourceGuild, _ := bot.State.Guild(sourceChannel.GuildID)
-				if sourceGuild != nil && sourceGuild.Name != "" {
-					sourceGuildName = "\"" + sourceGuild.Name + "\""
-				}
-			} else {
-				sourceGuildName = "Group Message" //?
-			}
-		} else {
-			sourceGuildName = "Direct Message"
-		}
-
-		subfolder := ""
-
-		// Subfolder Division - Server Nesting
-		if *channelConfig.DivideFoldersByServer {
-			subfolderSuffix := ""
-			if sourceGuildName != "" && sourceGuildName != "Unavailable" {
-				subfolderSuffix = sourceGuildName
-				for _, key := range pathBlacklist {
-					subfolderSuffix = strings.ReplaceAll(subfolderSuffix, key, "")
-				}
-			}
-			if subfolderSuffix != "" {
-				subfolderSuffix = subfolderSuffix + string(os.PathSeparator)
-				subfolder = subfolder + subfolderSuffix
-				// Create folder.
-				err := os.MkdirAll(path+subfolder, 0777)
-				if err != nil {
-					log.Println(logPrefixErrorHere, color.HiRedString("Error while creating server subfolder \"%s\": %s", path, err))
-					return mDownloadStatus(downloadFailedCreatingSubfolder, err)
+				if int64(buffer.Len()) <= maxSize {
+					img, _, err := image.Decode(bytes.NewReader(buffer.Bytes()))
+					if err != nil {
+						log.Println(color.HiRedString("Error converting buffer to image for hashing:\t%s", err))
+					} else {
+						var status *downloadStatusStruct
+						if imageHash, status = checkDuplicateImage(img, inputURL); status != nil {
+							return *status
+						}
+					}
 				}
+				body = io.MultiReader(buffer, body)
 			}
 		}
 
-		// Subfolder Division - Channel Nesting
-		if *channelConfig.DivideFoldersByChannel {
-			subfolderSuffix := ""
-			if sourceChannelName != "" {
-				subfolderSuffix = sourceChannelName
-				for _, key := range pathBlacklist {
-					subfolderSuffix = strings.ReplaceAll(subfolderSuffix, key, "")
-				}
-			}
-			if subfolderSuffix != "" {
-				subfolderSuffix = subfolderSuffix + string(os.PathSeparator)
-				subfolder = subfolder + subfolderSuffix
-				// Create folder.
-				err := os.MkdirAll(path+subfolder, 0777)
-				if err != nil {
-					log.Println(logPrefixErrorHere, color.HiRedString("Error while creating channel subfolder \"%s\": %s", path, err))
-					return mDownloadStatus(downloadFailedCreatingSubfolder, err)
-				}
-			}
+		completePath, contentTypeFound, status := getDownloadDestination(path, file, filename, extension, contentTypeFound, fileTime, message)
+		if status != nil {
+			return *status
 		}
 
-		// Subfolder Division - User Nesting
-		if *channelConfig.DivideFoldersByUser {
-			subfolderSuffix := message.Author.ID
-			if message.Author.Username != "" {
-				subfolderSuffix = message.Author.Username + "#" + message.Author.Discriminator
-				for _, key := range pathBlacklist {
-					subfolderSuffix = strings.ReplaceAll(subfolderSuffix, key, "")
-				}
-			}
-			if subfolderSuffix != "" {
-				subfolderSuffix = subfolderSuffix + string(os.PathSeparator)
-				subfolder = subfolder + subfolderSuffix
-				// Create folder.
-				err := os.MkdirAll(path+subfolder, 0777)
-				if err != nil {
-					log.Println(logPrefixErrorHere, color.HiRedString("Error while creating user subfolder \"%s\": %s", path, err))
-					return mDownloadStatus(downloadFailedCreatingSubfolder, err)
-				}
-			}
+		// Write to a partial file next to the destination, then move into place once complete
+		partPath := completePath + partialFileSuffix
+		partFile, err := os.OpenFile(partPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+		if err != nil {
+			log.Println(logPrefixErrorHere, color.HiRedString("Error while creating partial file for \"%s\": %s", inputURL, err))
+			return mDownloadStatus(downloadFailedWritingFile, err)
 		}
-
-		// Subfolder Division - Content Type
-		if *channelConfig.DivideFoldersByType {
-			subfolderSuffix := ""
-			switch contentTypeFound {
-			case "image":
-				subfolderSuffix = "images" + string(os.PathSeparator)
-			case "video":
-				subfolderSuffix = "videos" + string(os.PathSeparator)
-			case "audio":
-				subfolderSuffix = "audio" + string(os.PathSeparator)
-			case "text":
-				subfolderSuffix = "text" + string(os.PathSeparator)
-			case "application":
-				if stringInSlice(extension, []string{".mov"}) {
-					contentTypeFound = "video"
-					subfolderSuffix = "videos" + string(os.PathSeparator)
-				} else if stringInSlice(extension, []string{".psd"}) ||
-					stringInSlice(extension, []string{".nef"}) ||
-					stringInSlice(extension, []string{".dng"}) ||
-					stringInSlice(extension, []string{".tif"}) ||
-					stringInSlice(extension, []string{".tiff"}) {
-					contentTypeFound = "image"
-					subfolderSuffix = "images" + string(os.PathSeparator)
-				} else {
-					subfolderSuffix = "applications" + string(os.PathSeparator)
-				}
-			}
-			if subfolderSuffix != "" {
-				subfolder = subfolder + subfolderSuffix
-				// Create folder.
-				err := os.MkdirAll(path+subfolder, 0777)
-				if err != nil {
-					log.Println(logPrefixErrorHere, color.HiRedString("Error while creating type subfolder \"%s\": %s", path, err))
-					return mDownloadStatus(downloadFailedCreatingSubfolder, err)
-				}
+		// Servers taking ranged requests let an interrupted download pick up where it left off later
+		var resumable *partialDownload
+		if strings.ToLower(response.Header.Get("Accept-Ranges")) == "bytes" {
+			resumable = &partialDownload{
+				URL:          inputURL,
+				Filename:     filename,
+				Path:         path,
+				Destination:  completePath,
+				ContentType:  contentTypeFound,
+				MimeType:     contentType,
+				SourceURL:    file.SourceLink,
+				Extractor:    file.Extractor,
+				ETag:         response.Header.Get("ETag"),
+				LastModified: response.Header.Get("Last-Modified"),
+				Size:         response.ContentLength,
+				MessageID:    message.ID,
+				ChannelID:    message.ChannelID,
+				GuildID:      message.GuildID,
+				UserID:       message.Author.ID,
+				FileTime:     fileTime,
+				AudioLink:    file.AudioLink,
+				Time:         time.Now(),
 			}
+			savePartialDownload(resumable)
 		}
-
-		// Format filename/path
-		filenameDateFormat := config.FilenameDateFormat
-		if channelConfig.OverwriteFilenameDateFormat != nil {
-			if *channelConfig.OverwriteFilenameDateFormat != "" {
-				filenameDateFormat = *channelConfig.OverwriteFilenameDateFormat
+		discardPartial := func() {
+			if resumable != nil {
+				removePartialDownload(resumable)
+			} else {
+				os.Remove(partPath)
 			}
 		}
-		newFilename := time.Now().Format(filenameDateFormat) + filename
-		completePath := path + subfolder + newFilename
-
-		// Check if exists
-		if _, err := os.Stat(completePath); err == nil {
-			if *channelConfig.SavePossibleDuplicates {
-				tmpPath := completePath
-				i := 1
-				for {
-					// Append number to name
-					completePath = tmpPath[0:len(tmpPath)-len(filepathExtension(tmpPath))] +
-						"-" + strconv.Itoa(i) + filepathExtension(tmpPath)
-					if _, err := os.Stat(completePath); os.IsNotExist(err) {
-						break
-					}
-					i = i + 1
-				}
-				log.Println(color.GreenString("Matching filenames, possible duplicate? Saving \"%s\" as \"%s\" instead", tmpPath, completePath))
+		hasher := sha256.New()
+		written, err := io.Copy(io.MultiWriter(partFile, hasher), body)
+		partFile.Close()
+		if err != nil {
+			log.Println(logPrefixErrorHere, color.HiRedString("Error while streaming response to disk \"%s\": %s", inputURL, err))
+			if resumable != nil {
+				log.Println(color.YellowString("Kept partial download of %s for resuming", inputURL))
 			} else {
-				log.Println(logPrefixFileSkip, color.GreenString("Matching filenames, possible duplicate..."))
-				return mDownloadStatus(downloadSkippedDuplicate)
+				os.Remove(partPath)
 			}
+			return mDownloadStatus(downloadFailedReadResponse, err)
 		}
-
-		// Write
-		err = ioutil.WriteFile(completePath, bodyOfResp, 0644)
+		contentHash, written, _, status := checkWrittenFile(partPath, inputURL, file.AudioLink, extension, contentTypeFound,
+			hex.EncodeToString(hasher.Sum(nil)), written, false)
+		if status != nil {
+			discardPartial()
+			status.StatusCode = response.StatusCode
+			return *status
+		}
+		err = os.Rename(partPath, completePath)
 		if err != nil {
+			discardPartial()
 			log.Println(logPrefixErrorHere, color.HiRedString("Error while writing file to disk \"%s\": %s", inputURL, err))
 			return mDownloadStatus(downloadFailedWritingFile, err)
 		}
-
-		// Change file time
-		err = os.Chtimes(completePath, fileTime, fileTime)
-		if err != nil {
-			log.Println(logPrefixErrorHere, color.RedString("Error while changing metadata date \"%s\": %s", inputURL, err))
+		if resumable != nil {
+			removePartialDownload(resumable)
 		}
 
 		// Write duration
 		if config.DebugOutput {
 			log.Println(logPrefixDebug, color.YellowString("#%d - %s to save.", thisDownloadID, durafmt.ParseShort(time.Since(downloadTime)).String()))
 		}
-		writeTime := time.Now()
-
-		// Output
-		log.Println(color.HiGreenString("SAVED FILE (%s) sent in %s#%s to \"%s\"", contentTypeFound, sourceGuildName, sourceChannelName, completePath))
 
-		// Store in db
-		err = dbInsertDownload(&download{
+		finalStatus := finalizeDownload(file, &download{
 			URL:         inputURL,
-			Time:        time.Now(),
 			Destination: completePath,
 			Filename:    filename,
-			ChannelID:   message.ChannelID,
-			UserID:      message.Author.ID,
-		})
+			Size:        written,
+			ContentType: contentType,
+			Hash:        contentHash,
+		}, contentTypeFound, message, fileTime, historyCmd, thisDownloadID, startTime)
+		addDuplicateImage(finalStatus, thisDownloadID, imageHash)
+		return finalStatus
+	}
+	return mDownloadStatus(downloadFailed)
+}
+
+// Checks the channel's content type & extension settings, returns a status if the file should be skipped
+func checkFileAllowed(channelConfig configurationChannel, inputURL string, extension string, contentTypeFound string) *downloadStatusStruct {
+	// Check content type
+	if !((*channelConfig.SaveImages && contentTypeFound == "image") ||
+		(*channelConfig.SaveVideos && contentTypeFound == "video") ||
+		(*channelConfig.SaveAudioFiles && contentTypeFound == "audio") ||
+		(*channelConfig.SaveTextFiles && contentTypeFound == "text") ||
+		(*channelConfig.SaveOtherFiles && contentTypeFound == "application")) {
+		log.Println(logPrefixFileSkip, color.GreenString("Unpermitted filetype (%s) found at %s", contentTypeFound, inputURL))
+		status := mDownloadStatus(downloadSkippedUnpermittedType)
+		return &status
+	}
+
+	// Check extension
+	if stringInSlice(extension, *channelConfig.ExtensionBlacklist) || stringInSlice(extension, []string{".com", ".net", ".org"}) {
+		log.Println(logPrefixFileSkip, color.GreenString("Unpermitted extension (%s) found at %s", extension, inputURL))
+		status := mDownloadStatus(downloadSkippedUnpermittedExtension)
+		return &status
+	}
+
+	return nil
+}
+
+// Checks an image against the duplicate image filter, returns its hash for adding once it's saved
+// or a status if it's a duplicate
+func checkDuplicateImage(img image.Image, inputURL string) (*duplo.Hash, *downloadStatusStruct) {
+	config := getConfig()
+	hash, _ := duplo.CreateHash(img)
+	matches := imgStore.Query(hash)
+	sort.Sort(matches)
+	for _, match := range matches {
+		if match.Score < config.FilterDuplicateImagesThreshold {
+			log.Println(logPrefixFileSkip, color.GreenString("Duplicate detected (Score of %f) found at %s", match.Score, inputURL))
+			status := mDownloadStatus(downloadSkippedDetectedDuplicate)
+			return nil, &status
+		}
+	}
+	return &hash, nil
+}
+
+// Adds a downloaded image to the duplicate image filter, only when it was actually saved
+func addDuplicateImage(status downloadStatusStruct, id interface{}, hash *duplo.Hash) {
+	if hash == nil || status.Status != downloadSuccess || imgStore == nil {
+		return
+	}
+	imgStoreMutex.Lock()
+	imgStore.Add(id, *hash)
+	imgStoreMutex.Unlock()
+}
+
+// Builds the full save path from the channel's path & filename templates, creating folders as needed.
+// Returns a status if the file should not be saved.
+func getDownloadDestination(path string, file *fileItem, filename string, extension string, contentTypeFound string,
+	fileTime time.Time, message *discordgo.Message) (string, string, *downloadStatusStruct) {
+	logPrefixErrorHere := color.HiRedString("[getDownloadDestination]")
+	channelConfig := getChannelConfig(message.ChannelID)
+
+	contentTypeFound = getContentTypeFromExtension(contentTypeFound, extension)
+	values := getTemplateValues(file, filename, contentTypeFound, fileTime, message)
+
+	subfolder := applyPathTemplate(getPathTemplate(channelConfig), values)
+	if subfolder != "" {
+		subfolder = subfolder + string(os.PathSeparator)
+	}
+	newFilename := applyPathTemplate(getFilenameTemplate(channelConfig), values)
+	if newFilename == "" {
+		newFilename = filename
+	}
+	completePath := path + subfolder + newFilename
+
+	// Create folder
+	err := os.MkdirAll(filepath.Dir(completePath), 0777)
+	if err != nil {
+		log.Println(logPrefixErrorHere, color.HiRedString("Error while creating subfolder \"%s\": %s", filepath.Dir(completePath), err))
+		status := mDownloadStatus(downloadFailedCreatingSubfolder, err)
+		return "", contentTypeFound, &status
+	}
+
+	completePath, status := checkDestinationExists(completePath, channelConfig)
+	return completePath, contentTypeFound, status
+}
+
+// Numbers the file name if something is already saved there, or skips it if the channel doesn't save possible duplicates
+func checkDestinationExists(completePath string, channelConfig configurationChannel) (string, *downloadStatusStruct) {
+	if _, err := os.Stat(completePath); err == nil {
+		if *channelConfig.SavePossibleDuplicates {
+			tmpPath := completePath
+			completePath = numberedFilepath(tmpPath)
+			log.Println(color.GreenString("Matching filenames, possible duplicate? Saving \"%s\" as \"%s\" instead", tmpPath, completePath))
+		} else {
+			log.Println(logPrefixFileSkip, color.GreenString("Matching filenames, possible duplicate..."))
+			status := mDownloadStatus(downloadSkippedDuplicate)
+			return "", &status
+		}
+	}
+	return completePath, nil
+}
+
+// Checks for a complete file that wasn't streamed through tryDownload's checks, or only partly was: removed content
+// placeholders, the duplicate image filter (when checkImage) & merging Reddit audio. Hashes the file if contentHash is "".
+// Returns the final hash & size, the image hash to add to the filter once saved, or a status if it shouldn't be kept.
+func checkWrittenFile(path string, inputURL string, audioLink string, extension string, contentTypeFound string,
+	contentHash string, size int64, checkImage bool) (string, int64, *duplo.Hash, *downloadStatusStruct) {
+	logPrefixErrorHere := color.HiRedString("[checkWrittenFile]")
+	config := getConfig()
+
+	if contentHash == "" {
+		var err error
+		if contentHash, size, err = getFileHash(path); err != nil {
+			log.Println(logPrefixErrorHere, color.HiRedString("Error while hashing \"%s\": %s", path, err))
+			status := mDownloadStatus(downloadFailedReadResponse, err)
+			return "", 0, nil, &status
+		}
+	}
+	if isPlaceholderHash(contentHash) {
+		log.Println(logPrefixErrorHere, color.HiRedString("\"%s\" matches a known removed content placeholder", inputURL))
+		status := mDownloadStatus(downloadFailedPlaceholder)
+		return "", 0, nil, &status
+	}
+
+	var imageHash *duplo.Hash
+	if checkImage && config.FilterDuplicateImages && imgStore != nil && contentTypeFound == "image" &&
+		extension != ".gif" && extension != ".webp" && size <= config.FilterDuplicateImagesMaxSize*1024*1024 {
+		if imageFile, err := os.Open(path); err == nil {
+			img, _, err := image.Decode(imageFile)
+			imageFile.Close()
+			if err != nil {
+				log.Println(color.HiRedString("Error converting file to image for hashing:\t%s", err))
+			} else {
+				var status *downloadStatusStruct
+				if imageHash, status = checkDuplicateImage(img, inputURL); status != nil {
+					return "", 0, nil, status
+				}
+			}
+		}
+	}
+
+	if audioLink != "" && config.FfmpegPath != "" {
+		if err := muxRedditAudio(path, audioLink); err != nil {
+			log.Println(logPrefixErrorHere, color.HiRedString("Error while adding audio to \"%s\", keeping video only: %s", inputURL, err))
+		} else if muxedHash, muxedSize, err := getFileHash(path); err == nil {
+			contentHash, size = muxedHash, muxedSize
+		}
+	}
+	return contentHash, size, imageHash, nil
+}
+
+// Some formats are sniffed as generic application data
+func getContentTypeFromExtension(contentTypeFound string, extension string) string {
+	if contentTypeFound == "application" {
+		if stringInSlice(extension, []string{".mov"}) {
+			return "video"
+		} else if stringInSlice(extension, []string{".psd", ".nef", ".dng", ".tif", ".tiff"}) {
+			return "image"
+		}
+	}
+	return contentTypeFound
+}
+
+// Steps shared by every download once the file is in place: metadata, database, reaction & presence
+// The record needs URL, Destination, Filename & file details filled in, the rest is taken from the file & message.
+func finalizeDownload(file *fileItem, record *download, contentTypeFound string,
+	message *discordgo.Message, fileTime time.Time, historyCmd bool, thisDownloadID int, startTime time.Time) downloadStatusStruct {
+	config := getConfig()
+	logPrefixErrorHere := color.HiRedString("[finalizeDownload]")
+	inputURL := record.URL
+	completePath := record.Destination
+	channelConfig := getChannelConfig(message.ChannelID)
+	sourceGuildName, sourceChannelName := getSourceNames(message.ChannelID)
+	writeTime := time.Now()
+
+	record.SourceURL = file.SourceLink
+	if record.SourceURL == "" {
+		record.SourceURL = inputURL
+	}
+	record.Extractor = file.Extractor
+	record.Time = time.Now()
+	record.ChannelID = message.ChannelID
+	record.UserID = message.Author.ID
+	record.MessageID = message.ID
+	record.GuildID = message.GuildID
+	record.Duration = time.Since(startTime)
+
+	// Same content downloaded before
+	applyDuplicatePolicy(record, channelConfig)
+	if record.DuplicateOf != 0 && record.DuplicatePolicy == duplicatePolicySkip {
+		log.Println(logPrefixFileSkip, color.GreenString("Same content as \"%s\" found at %s", record.Destination, inputURL))
+		err := dbInsertDownload(record)
 		if err != nil {
 			log.Println(logPrefixErrorHere, color.HiRedString("Error writing to database: %s", err))
 			return mDownloadStatus(downloadFailedWritingDatabase, err)
 		}
+		return mDownloadStatus(downloadSkippedDuplicate)
+	}
 
-		// Storage & output duration
-		if config.DebugOutput {
-			log.Println(logPrefixDebug, color.YellowString("#%d - %s to update database.", thisDownloadID, durafmt.ParseShort(time.Since(writeTime)).String()))
+	// Change file time, links would change the original instead
+	var err error
+	if record.DuplicateOf == 0 || record.DuplicatePolicy == duplicatePolicySave {
+		err = os.Chtimes(completePath, fileTime, fileTime)
+		if err != nil {
+			log.Println(logPrefixErrorHere, color.RedString("Error while changing metadata date \"%s\": %s", inputURL, err))
 		}
-		finishTime := time.Now()
+	}
 
-		// React
-		if !historyCmd && *channelConfig.ReactWhenDownloaded {
-			reaction := ""
-			if *channelConfig.ReactWhenDownloadedEmoji == "" {
-				if sourceChannel.GuildID != "" {
-					guild, err := bot.State.Guild(message.GuildID)
-					if err != nil {
-						log.Println(logPrefixErrorHere, color.RedString("Error fetching guild state for emojis from %s: %s", message.GuildID, err))
-					} else {
-						emojis := guild.Emojis
-						if len(emojis) > 1 {
-							for {
-								rand.Seed(time.Now().UnixNano())
-								chosenEmoji := emojis[rand.Intn(len(emojis))]
-								formattedEmoji := chosenEmoji.APIName()
-								if !chosenEmoji.Animated && !stringInSlice(formattedEmoji, *channelConfig.BlacklistReactEmojis) {
-									reaction = formattedEmoji
-									break
-								}
+	// Output
+	if record.DuplicateOf != 0 && record.DuplicatePolicy != duplicatePolicySave {
+		log.Println(color.HiGreenString("LINKED FILE (%s) sent in %s#%s to \"%s\" (%s of existing copy)",
+			contentTypeFound, sourceGuildName, sourceChannelName, completePath, record.DuplicatePolicy))
+	} else {
+		log.Println(color.HiGreenString("SAVED FILE (%s) sent in %s#%s to \"%s\"", contentTypeFound, sourceGuildName, sourceChannelName, completePath))
+	}
+
+	// Store in db
+	err = dbInsertDownload(record)
+	if err != nil {
+		log.Println(logPrefixErrorHere, color.HiRedString("Error writing to database: %s", err))
+		return mDownloadStatus(downloadFailedWritingDatabase, err)
+	}
+
+	// Storage & output duration
+	if config.DebugOutput {
+		log.Println(logPrefixDebug, color.YellowString("#%d - %s to update database.", thisDownloadID, durafmt.ParseShort(time.Since(writeTime)).String()))
+	}
+	finishTime := time.Now()
+
+	// React
+	if !historyCmd && *channelConfig.ReactWhenDownloaded {
+		reaction := ""
+		if *channelConfig.ReactWhenDownloadedEmoji == "" {
+			sourceChannel, _ := bot.State.Channel(message.ChannelID)
+			if sourceChannel != nil && sourceChannel.GuildID != "" {
+				guild, err := bot.State.Guild(sourceChannel.GuildID)
+				if err != nil {
+					log.Println(logPrefixErrorHere, color.RedString("Error fetching guild state for emojis from %s: %s", sourceChannel.GuildID, err))
+				} else {
+					emojis := guild.Emojis
+					if len(emojis) > 1 {
+						for {
+							rand.Seed(time.Now().UnixNano())
+							chosenEmoji := emojis[rand.Intn(len(emojis))]
+							formattedEmoji := chosenEmoji.APIName()
+							if !chosenEmoji.Animated && !stringInSlice(formattedEmoji, *channelConfig.BlacklistReactEmojis) {
+								reaction = formattedEmoji
+								break
 							}
-						} else {
-							reaction = "✅"
 						}
+					} else {
+						reaction = "✅"
 					}
-				} else {
-					reaction = "✅"
 				}
 			} else {
-				reaction = *channelConfig.ReactWhenDownloadedEmoji
-			}
-			err = bot.MessageReactionAdd(message.ChannelID, message.ID, reaction)
-			if err != nil {
-				log.Println(logPrefixErrorHere, color.RedString("Error adding reaction to message: %s", err))
-			}
-			// React duration
-			if config.DebugOutput {
-				log.Println(logPrefixDebug, color.YellowString("#%d - %s to react with \"%s\".", thisDownloadID, durafmt.ParseShort(time.Since(finishTime)).String(), reaction))
+				reaction = "✅"
 			}
+		} else {
+			reaction = *channelConfig.ReactWhenDownloadedEmoji
 		}
-
-		timeLastUpdated = time.Now()
-		if *channelConfig.UpdatePresence {
-			updateDiscordPresence()
+		err = bot.MessageReactionAdd(message.ChannelID, message.ID, reaction)
+		if err != nil {
+			log.Println(logPrefixErrorHere, color.RedString("Error adding reaction to message: %s", err))
 		}
-
+		// React duration
 		if config.DebugOutput {
-			log.Println(logPrefixDebug, color.YellowString("#%d - %s total.", thisDownloadID, time.Since(startTime)))
+			log.Println(logPrefixDebug, color.YellowString("#%d - %s to react with \"%s\".", thisDownloadID, durafmt.ParseShort(time.Since(finishTime)).String(), reaction))
 		}
+	}
 
-		return mDownloadStatus(downloadSuccess)
+	timeLastUpdated = time.Now()
+	if *channelConfig.UpdatePresence {
+		updateDiscordPresence()
 	}
-	return mDownloadStatus(downloadFailed)
+
+	if config.DebugOutput {
+		log.Println(logPrefixDebug, color.YellowString("#%d - %s total.", thisDownloadID, time.Since(startTime)))
+	}
+
+	return mDownloadStatus(downloadSuccess)
+}
+
+// SHA-256 & size of a file on disk
+func getFileHash(path string) (string, int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", 0, err
+	}
+	defer f.Close()
+	hasher := sha256.New()
+	size, err := io.Copy(hasher, f)
+	if err != nil {
+		return "", 0, err
+	}
+	return hex.EncodeToString(hasher.Sum(nil)), size, nil
+}
+
+// Returns the guild & channel labels used in output and folder names
+func getSourceNames(channelID string) (string, string) {
+	sourceChannelName := channelID
+	sourceGuildName := "Unavailable"
+	sourceChannel, err := bot.State.Channel(channelID)
+	if err != nil {
+		log.Println(color.HiRedString("[getSourceNames] Error fetching channel state for %s: %s", channelID, err))
+	}
+	if sourceChannel != nil && sourceChannel.Name != "" {
+		sourceChannelName = sourceChannel.Name
+		if sourceChannel.GuildID != "" {
+			sourceGuild, _ := bot.State.Guild(sourceChannel.GuildID)
+			if sourceGuild != nil && sourceGuild.Name != "" {
+				sourceGuildName = "\"" + sourceGuild.Name + "\""
+			}
+		} else {
+			sourceGuildName = "Group Message" //?
+		}
+	} else {
+		sourceGuildName = "Direct Message"
+	}
+	return sourceGuildName, sourceChannelName
+}
+
+// Appends an incrementing number to the filename until the path is unused
+func numberedFilepath(completePath string) string {
+	newPath := completePath
+	i := 1
+	for {
+		// Append number to name
+		newPath = completePath[0:len(completePath)-len(filepathExtension(completePath))] +
+			"-" + strconv.Itoa(i) + filepathExtension(completePath)
+		if _, err := os.Stat(newPath); os.IsNotExist(err) {
+			break
+		}
+		i = i + 1
+	}
+	return newPath
 }
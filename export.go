@@ -0,0 +1,323 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	exportFormatJSONL = "jsonl"
+	exportFormatCSV   = "csv"
+)
+
+// Download record as written to export files, field names match the database columns
+type exportedDownload struct {
+	ID              int64  `json:"id"`
+	URL             string `json:"url"`
+	SourceURL       string `json:"source_url"`
+	Time            string `json:"time"`
+	Destination     string `json:"destination"`
+	Filename        string `json:"filename"`
+	ChannelID       string `json:"channel_id"`
+	UserID          string `json:"user_id"`
+	MessageID       string `json:"message_id"`
+	GuildID         string `json:"guild_id"`
+	Size            int64  `json:"size"`
+	ContentType     string `json:"content_type"`
+	Hash            string `json:"hash"`
+	Extractor       string `json:"extractor"`
+	DurationMs      int64  `json:"duration_ms"`
+	DuplicateOf     int64  `json:"duplicate_of"`
+	DuplicatePolicy string `json:"duplicate_policy"`
+}
+
+var exportCSVHeader = []string{"id", "url", "source_url", "time", "destination", "filename", "channel_id", "user_id",
+	"message_id", "guild_id", "size", "content_type", "hash", "extractor", "duration_ms", "duplicate_of", "duplicate_policy"}
+
+func newExportedDownload(record *download) exportedDownload {
+	return exportedDownload{
+		ID:              record.ID,
+		URL:             record.URL,
+		SourceURL:       record.SourceURL,
+		Time:            record.Time.Format(time.RFC3339Nano),
+		Destination:     record.Destination,
+		Filename:        record.Filename,
+		ChannelID:       record.ChannelID,
+		UserID:          record.UserID,
+		MessageID:       record.MessageID,
+		GuildID:         record.GuildID,
+		Size:            record.Size,
+		ContentType:     record.ContentType,
+		Hash:            record.Hash,
+		Extractor:       record.Extractor,
+		DurationMs:      record.Duration.Milliseconds(),
+		DuplicateOf:     record.DuplicateOf,
+		DuplicatePolicy: record.DuplicatePolicy,
+	}
+}
+
+func (record exportedDownload) toDownload() (*download, error) {
+	if record.URL == "" {
+		return nil, fmt.Errorf("record has no url")
+	}
+	recordTime, err := time.Parse(time.RFC3339Nano, record.Time)
+	if err != nil {
+		return nil, fmt.Errorf("invalid time \"%s\"", record.Time)
+	}
+	return &download{
+		ID:              record.ID,
+		URL:             record.URL,
+		SourceURL:       record.SourceURL,
+		Time:            recordTime,
+		Destination:     record.Destination,
+		Filename:        record.Filename,
+		ChannelID:       record.ChannelID,
+		UserID:          record.UserID,
+		MessageID:       record.MessageID,
+		GuildID:         record.GuildID,
+		Size:            record.Size,
+		ContentType:     record.ContentType,
+		Hash:            record.Hash,
+		Extractor:       record.Extractor,
+		Duration:        time.Duration(record.DurationMs) * time.Millisecond,
+		DuplicateOf:     record.DuplicateOf,
+		DuplicatePolicy: record.DuplicatePolicy,
+	}, nil
+}
+
+func (record exportedDownload) csvRow() []string {
+	return []string{
+		strconv.FormatInt(record.ID, 10), record.URL, record.SourceURL, record.Time, record.Destination, record.Filename,
+		record.ChannelID, record.UserID, record.MessageID, record.GuildID, strconv.FormatInt(record.Size, 10),
+		record.ContentType, record.Hash, record.Extractor, strconv.FormatInt(record.DurationMs, 10),
+		strconv.FormatInt(record.DuplicateOf, 10), record.DuplicatePolicy,
+	}
+}
+
+// Columns are looked up by header name so exports from older or newer versions still line up
+func exportedDownloadFromCSV(header map[string]int, row []string) exportedDownload {
+	get := func(column string) string {
+		if i, ok := header[column]; ok && i < len(row) {
+			return row[i]
+		}
+		return ""
+	}
+	getInt := func(column string) int64 {
+		value, _ := strconv.ParseInt(get(column), 10, 64)
+		return value
+	}
+	return exportedDownload{
+		ID:              getInt("id"),
+		URL:             get("url"),
+		SourceURL:       get("source_url"),
+		Time:            get("time"),
+		Destination:     get("destination"),
+		Filename:        get("filename"),
+		ChannelID:       get("channel_id"),
+		UserID:          get("user_id"),
+		MessageID:       get("message_id"),
+		GuildID:         get("guild_id"),
+		Size:            getInt("size"),
+		ContentType:     get("content_type"),
+		Hash:            get("hash"),
+		Extractor:       get("extractor"),
+		DurationMs:      getInt("duration_ms"),
+		DuplicateOf:     getInt("duplicate_of"),
+		DuplicatePolicy: get("duplicate_policy"),
+	}
+}
+
+// Format from the file extension, JSON Lines unless it ends with .csv
+func getExportFormat(path string) string {
+	if strings.EqualFold(filepath.Ext(path), ".csv") {
+		return exportFormatCSV
+	}
+	return exportFormatJSONL
+}
+
+func isExportFormat(format string) bool {
+	return format == exportFormatJSONL || format == exportFormatCSV
+}
+
+// Accepts a date (2006-01-02) or a full RFC3339 time. A bare date used as an upper bound
+// covers the whole day.
+func parseExportDate(value string, endOfDay bool) (time.Time, error) {
+	if parsed, err := time.Parse(time.RFC3339, value); err == nil {
+		return parsed, nil
+	}
+	parsed, err := time.ParseInLocation("2006-01-02", value, time.Local)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid date \"%s\", use YYYY-MM-DD or RFC3339", value)
+	}
+	if endOfDay {
+		parsed = parsed.AddDate(0, 0, 1)
+	}
+	return parsed, nil
+}
+
+func writeDownloadExport(w io.Writer, format string, downloads []*download) error {
+	switch format {
+	case exportFormatCSV:
+		writer := csv.NewWriter(w)
+		if err := writer.Write(exportCSVHeader); err != nil {
+			return err
+		}
+		for _, record := range downloads {
+			if err := writer.Write(newExportedDownload(record).csvRow()); err != nil {
+				return err
+			}
+		}
+		writer.Flush()
+		return writer.Error()
+	case exportFormatJSONL:
+		encoder := json.NewEncoder(w)
+		for _, record := range downloads {
+			if err := encoder.Encode(newExportedDownload(record)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown export format \"%s\"", format)
+}
+
+// Reads every record, a bad line fails the whole import so nothing is half-merged
+func readDownloadExport(r io.Reader, format string) ([]*download, error) {
+	var downloads []*download
+	switch format {
+	case exportFormatCSV:
+		reader := csv.NewReader(r)
+		reader.FieldsPerRecord = -1
+		headerRow, err := reader.Read()
+		if err == io.EOF {
+			return downloads, nil
+		} else if err != nil {
+			return nil, err
+		}
+		header := make(map[string]int)
+		for i, column := range headerRow {
+			header[strings.TrimSpace(strings.TrimPrefix(column, "\ufeff"))] = i
+		}
+		if _, ok := header["url"]; !ok {
+			return nil, fmt.Errorf("csv header has no url column")
+		}
+		for {
+			row, err := reader.Read()
+			if err == io.EOF {
+				break
+			} else if err != nil {
+				return nil, err
+			}
+			line, _ := reader.FieldPos(0)
+			record, err := exportedDownloadFromCSV(header, row).toDownload()
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %s", line, err)
+			}
+			downloads = append(downloads, record)
+		}
+	case exportFormatJSONL:
+		scanner := bufio.NewScanner(r)
+		scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+		line := 0
+		for scanner.Scan() {
+			line++
+			text := strings.TrimSpace(scanner.Text())
+			if text == "" {
+				continue
+			}
+			var exported exportedDownload
+			if err := json.Unmarshal([]byte(text), &exported); err != nil {
+				return nil, fmt.Errorf("line %d: %s", line, err)
+			}
+			record, err := exported.toDownload()
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %s", line, err)
+			}
+			downloads = append(downloads, record)
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unknown export format \"%s\"", format)
+	}
+	return downloads, nil
+}
+
+// Reads command arguments like "csv channel:<id> user:<id> since:<date> until:<date>"
+func parseExportArgs(args []string) (string, downloadFilter, error) {
+	format := exportFormatJSONL
+	var filter downloadFilter
+	for _, arg := range args {
+		arg = strings.TrimSpace(arg)
+		if arg == "" {
+			continue
+		}
+		key, value := "", arg
+		if i := strings.Index(arg, ":"); i != -1 {
+			key, value = strings.ToLower(arg[:i]), arg[i+1:]
+		}
+		var err error
+		switch key {
+		case "":
+			if !isExportFormat(strings.ToLower(value)) {
+				return "", filter, fmt.Errorf("unknown format \"%s\", use jsonl or csv", value)
+			}
+			format = strings.ToLower(value)
+		case "channel":
+			filter.ChannelID = value
+		case "user":
+			filter.UserID = value
+		case "since":
+			filter.Since, err = parseExportDate(value, false)
+		case "until":
+			filter.Until, err = parseExportDate(value, true)
+		default:
+			err = fmt.Errorf("unknown option \"%s\"", key)
+		}
+		if err != nil {
+			return "", filter, err
+		}
+	}
+	return format, filter, nil
+}
+
+// Exports records matching the filter to a file, returns how many were written
+func exportDownloadsToFile(path string, format string, filter downloadFilter) (int, error) {
+	downloads, err := myDB.FindDownloads(filter)
+	if err != nil {
+		return 0, err
+	}
+	file, err := os.Create(path)
+	if err != nil {
+		return 0, err
+	}
+	if err := writeDownloadExport(file, format, downloads); err != nil {
+		file.Close()
+		return 0, err
+	}
+	return len(downloads), file.Close()
+}
+
+// Merges an export into the database, returns how many records were read and how many were new
+func importDownloadsFromFile(path string, format string) (int, int, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer file.Close()
+	downloads, err := readDownloadExport(file, format)
+	if err != nil {
+		return 0, 0, err
+	}
+	imported, err := myDB.ImportDownloads(downloads)
+	return len(downloads), imported, err
+}
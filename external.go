@@ -0,0 +1,475 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/fatih/color"
+)
+
+const (
+	externalProgramYtdlp     = "yt-dlp"
+	externalProgramGallerydl = "gallery-dl"
+
+	externalDefaultTimeout       = 600
+	externalDefaultMaxConcurrent = 1
+	externalMaxErrorLength       = 1000
+)
+
+var (
+	externalSlots      = map[string]chan struct{}{}
+	externalSlotsMutex sync.Mutex
+
+	// Errors both programs print for links that won't ever work, matched case-insensitively
+	externalPermanentErrors = []string{
+		"unsupported url",
+		"private video",
+		"video is private",
+		"video unavailable",
+		"has been removed",
+		"no video formats found",
+		"http error 404",
+		"http error 410",
+		"404 not found",
+	}
+)
+
+// Hands links on configured domains to yt-dlp or gallery-dl, the actual download happens in the queue
+type externalExtractor struct{}
+
+func (e *externalExtractor) Name() string {
+	return "external"
+}
+
+func (e *externalExtractor) Match(link string) bool {
+	return getExternalDownloader(link) != nil
+}
+
+func (e *externalExtractor) Extract(ctx context.Context, link string, channelID string) ([]*fileItem, error) {
+	downloader := getExternalDownloader(link)
+	if downloader == nil {
+		return nil, nil
+	}
+	return []*fileItem{{
+		Link:      link,
+		Extractor: downloader.Program,
+		External:  true,
+	}}, nil
+}
+
+func isExternalProgramSupported(program string) bool {
+	return program == externalProgramYtdlp || program == externalProgramGallerydl
+}
+
+// Finds the first rule with a domain matching the link, subdomains included
+func getExternalDownloader(link string) *configurationExternalDownloader {
+	config := getConfig()
+	u, err := url.Parse(link)
+	if err != nil {
+		return nil
+	}
+	host := strings.ToLower(u.Hostname())
+	for i, item := range config.ExternalDownloaders {
+		if !isExternalProgramSupported(item.Program) {
+			continue
+		}
+		for _, domain := range item.Domains {
+			domain = strings.ToLower(domain)
+			if host == domain || strings.HasSuffix(host, "."+domain) {
+				return &config.ExternalDownloaders[i]
+			}
+		}
+	}
+	return nil
+}
+
+func (d *configurationExternalDownloader) getPath() string {
+	if d.Path != "" {
+		return d.Path
+	}
+	return d.Program
+}
+
+func (d *configurationExternalDownloader) getTimeout() time.Duration {
+	if d.Timeout != nil && *d.Timeout > 0 {
+		return time.Duration(*d.Timeout) * time.Second
+	}
+	return externalDefaultTimeout * time.Second
+}
+
+// Limits how many instances of a program run at once for a rule.
+// Rules are told apart by their settings, so a changed limit gets its own slots while running ones finish.
+func (d *configurationExternalDownloader) acquireSlot() func() {
+	limit := externalDefaultMaxConcurrent
+	if d.MaxConcurrent != nil && *d.MaxConcurrent > 0 {
+		limit = *d.MaxConcurrent
+	}
+	key := fmt.Sprintf("%s|%s|%d", d.getPath(), strings.Join(d.Domains, ","), limit)
+
+	externalSlotsMutex.Lock()
+	slots, exists := externalSlots[key]
+	if !exists {
+		slots = make(chan struct{}, limit)
+		externalSlots[key] = slots
+	}
+	externalSlotsMutex.Unlock()
+
+	slots <- struct{}{}
+	return func() { <-slots }
+}
+
+func (d *configurationExternalDownloader) getArguments(link string, outputPath string) []string {
+	var args []string
+	switch d.Program {
+	case externalProgramYtdlp:
+		args = []string{
+			"--no-progress", "--no-playlist", "--no-mtime", "--write-info-json",
+			"--paths", outputPath,
+			"--output", "%(title).150B [%(id)s].%(ext)s",
+		}
+	case externalProgramGallerydl:
+		args = []string{
+			"--write-metadata",
+			"--directory", outputPath,
+		}
+	}
+	args = append(args, d.Arguments...)
+	return append(args, "--", link)
+}
+
+// Both programs write a JSON file next to every download, only the fields we use
+type externalMetadata struct {
+	Title     string   `json:"title"`
+	Timestamp *float64 `json:"timestamp"` // yt-dlp
+	Date      string   `json:"date"`      // gallery-dl
+	Extractor string   `json:"extractor"` // yt-dlp
+	Category  string   `json:"category"`  // gallery-dl
+}
+
+func (m *externalMetadata) getTime() time.Time {
+	if m.Timestamp != nil {
+		return time.Unix(int64(*m.Timestamp), 0)
+	}
+	if m.Date != "" {
+		if t, err := time.Parse("2006-01-02 15:04:05", m.Date); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+func (m *externalMetadata) getSite() string {
+	if m.Extractor != "" {
+		return m.Extractor
+	}
+	return m.Category
+}
+
+// Metadata file names, yt-dlp replaces the extension while gallery-dl appends to it
+func getExternalMetadataPaths(file string) []string {
+	return []string{
+		strings.TrimSuffix(file, filepath.Ext(file)) + ".info.json",
+		file + ".json",
+	}
+}
+
+func readExternalMetadata(file string) *externalMetadata {
+	for _, metadataPath := range getExternalMetadataPaths(file) {
+		data, err := ioutil.ReadFile(metadataPath)
+		if err != nil {
+			continue
+		}
+		var metadata externalMetadata
+		if json.Unmarshal(data, &metadata) == nil {
+			return &metadata
+		}
+	}
+	return nil
+}
+
+// Collects downloaded files, leaving out metadata & leftover partial files
+func getExternalOutputFiles(outputPath string) ([]string, error) {
+	var all []string
+	err := filepath.Walk(outputPath, func(file string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			all = append(all, file)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	metadataFiles := map[string]bool{}
+	for _, file := range all {
+		for _, metadataPath := range getExternalMetadataPaths(file) {
+			metadataFiles[metadataPath] = true
+		}
+	}
+	var files []string
+	for _, file := range all {
+		if metadataFiles[file] || strings.HasSuffix(file, partialFileSuffix) || strings.HasSuffix(file, ".ytdl") {
+			continue
+		}
+		files = append(files, file)
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// Logs a program's output line by line while it runs, for debug output
+type externalOutputLogger struct {
+	prefix  string
+	mutex   sync.Mutex
+	pending []byte
+}
+
+func (l *externalOutputLogger) Write(p []byte) (int, error) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.pending = append(l.pending, p...)
+	for {
+		end := bytes.IndexByte(l.pending, '\n')
+		if end < 0 {
+			break
+		}
+		l.logLine(string(l.pending[:end]))
+		l.pending = l.pending[end+1:]
+	}
+	return len(p), nil
+}
+
+// Logs whatever is left without a line break
+func (l *externalOutputLogger) flush() {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.logLine(string(l.pending))
+	l.pending = nil
+}
+
+func (l *externalOutputLogger) logLine(line string) {
+	if line = strings.TrimSpace(line); line != "" {
+		log.Println(logPrefixDebug, l.prefix, line)
+	}
+}
+
+func isExternalPermanentError(output string) bool {
+	output = strings.ToLower(output)
+	for _, message := range externalPermanentErrors {
+		if strings.Contains(output, message) {
+			return true
+		}
+	}
+	return false
+}
+
+// Keeps the end of the output, that's where both programs print the actual error
+func trimExternalError(output string) string {
+	output = strings.TrimSpace(output)
+	if len(output) > externalMaxErrorLength {
+		output = "..." + output[len(output)-externalMaxErrorLength:]
+	}
+	return output
+}
+
+func tryExternalDownload(file *fileItem, path string, message *discordgo.Message, historyCmd bool) downloadStatusStruct {
+	config := getConfig()
+	inputURL := file.Link
+	startTime := time.Now()
+	logPrefixErrorHere := color.HiRedString("[tryExternalDownload]")
+
+	downloader := getExternalDownloader(inputURL)
+	if downloader == nil {
+		return mDownloadStatus(downloadFailedExternal, fmt.Errorf("no external downloader configured for %s", inputURL))
+	}
+	if isDomainBlacklisted(getChannelConfig(message.ChannelID), inputURL) {
+		log.Println(logPrefixFileSkip, color.GreenString("Unpermitted domain (%s) found at %s", getDownloadDomain(inputURL), inputURL))
+		return mDownloadStatus(downloadSkippedUnpermittedDomain)
+	}
+
+	// Clean/fix path
+	if !strings.HasSuffix(path, string(os.PathSeparator)) {
+		path = path + string(os.PathSeparator)
+	}
+	err := os.MkdirAll(path, 0777)
+	if err != nil {
+		log.Println(logPrefixErrorHere, color.HiRedString("Error while creating destination folder \"%s\": %s", path, err))
+		return mDownloadStatus(downloadFailedCreatingFolder, err)
+	}
+
+	// Files are moved out of here once the program is done
+	outputPath, err := ioutil.TempDir(path, ".external-")
+	if err != nil {
+		log.Println(logPrefixErrorHere, color.HiRedString("Error while creating temporary folder in \"%s\": %s", path, err))
+		return mDownloadStatus(downloadFailedCreatingFolder, err)
+	}
+	defer os.RemoveAll(outputPath)
+
+	release := downloader.acquireSlot()
+	timeout := downloader.getTimeout()
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, downloader.getPath(), downloader.getArguments(inputURL, outputPath)...)
+	cmd.Stderr = &stderr
+	var outputLogger *externalOutputLogger
+	if config.DebugOutput {
+		outputLogger = &externalOutputLogger{prefix: color.CyanString("[%s]", downloader.Program)}
+		cmd.Stdout = outputLogger
+		cmd.Stderr = io.MultiWriter(&stderr, outputLogger)
+		log.Println(logPrefixDebug, color.YellowString("Running %s for %s...", downloader.Program, inputURL))
+	}
+	waitForDomain(inputURL)
+	err = cmd.Run()
+	timedOut := ctx.Err() == context.DeadlineExceeded
+	cancel()
+	release()
+	if outputLogger != nil {
+		outputLogger.flush()
+	}
+
+	if err != nil {
+		status := downloadFailedExternal
+		if timedOut {
+			err = fmt.Errorf("%s timed out after %s", downloader.Program, timeout)
+		} else if output := trimExternalError(stderr.String()); output != "" {
+			err = errors.New(output)
+			if isExternalPermanentError(output) {
+				status = downloadFailedExternalPermanent
+			}
+		}
+		log.Println(logPrefixErrorHere, color.HiRedString("%s failed for \"%s\": %s", downloader.Program, inputURL, err))
+		return mDownloadStatus(status, err)
+	}
+
+	files, err := getExternalOutputFiles(outputPath)
+	if err != nil {
+		return mDownloadStatus(downloadFailedExternal, err)
+	}
+	if len(files) == 0 {
+		err = fmt.Errorf("%s did not save any files", downloader.Program)
+		if output := trimExternalError(stderr.String()); output != "" {
+			err = fmt.Errorf("%s -- %s", err, output)
+		}
+		log.Println(logPrefixErrorHere, color.HiRedString("%s for \"%s\"", err, inputURL))
+		return mDownloadStatus(downloadFailedExternal, err)
+	}
+
+	// Every file goes through the same checks & steps as a regular download
+	saved, failed := 0, 0
+	var status downloadStatusStruct
+	for _, outputFile := range files {
+		fileStatus := saveExternalFile(file, outputFile, inputURL, path, message, historyCmd, startTime)
+		if fileStatus.Status == downloadSuccess {
+			saved++
+			continue
+		}
+		if fileStatus.Status >= downloadFailed {
+			failed++
+		}
+		status = fileStatus
+	}
+	if saved > 0 && failed > 0 {
+		err = fmt.Errorf("saved %d of %d files from %s", saved, len(files), downloader.Program)
+		if status.Error != nil {
+			err = fmt.Errorf("%s -- %s", err, status.Error)
+		}
+		log.Println(logPrefixErrorHere, color.HiRedString("%s for \"%s\"", err, inputURL))
+		return mDownloadStatus(downloadFailedExternalPartial, err)
+	}
+	if saved > 0 {
+		return mDownloadStatus(downloadSuccess)
+	}
+	return status
+}
+
+func saveExternalFile(file *fileItem, outputFile string, inputURL string, path string,
+	message *discordgo.Message, historyCmd bool, startTime time.Time) downloadStatusStruct {
+	config := getConfig()
+	logPrefixErrorHere := color.HiRedString("[saveExternalFile]")
+	channelConfig := getChannelConfig(message.ChannelID)
+	thisDownloadID := int(atomic.AddInt64(&cachedDownloadID, 1))
+	filename := filepath.Base(outputFile)
+	extension := strings.ToLower(filepath.Ext(filename))
+
+	// The post date reported by the program counts as last modified
+	var lastModified time.Time
+	if metadata := readExternalMetadata(outputFile); metadata != nil {
+		lastModified = metadata.getTime()
+		if config.DebugOutput {
+			log.Println(logPrefixDebug, color.YellowString("#%d - %s \"%s\" from %s", thisDownloadID, metadata.getSite(), metadata.Title, inputURL))
+		}
+	}
+
+	fileTime := getFileDate(channelConfig, file.Time, lastModified)
+
+	contentType, err := getFileContentType(outputFile)
+	if err != nil {
+		log.Println(logPrefixErrorHere, color.HiRedString("Could not read \"%s\": %s", outputFile, err))
+		return mDownloadStatus(downloadFailedReadResponse, err)
+	}
+	contentTypeFound := strings.Split(contentType, "/")[0]
+	if status := checkFileAllowed(channelConfig, inputURL, extension, contentTypeFound); status != nil {
+		return *status
+	}
+
+	contentHash, size, imageHash, status := checkWrittenFile(outputFile, inputURL, "", extension, contentTypeFound, "", 0, true)
+	if status != nil {
+		return *status
+	}
+
+	completePath, contentTypeFound, status := getDownloadDestination(path, file, filename, extension, contentTypeFound, fileTime, message)
+	if status != nil {
+		return *status
+	}
+	err = os.Rename(outputFile, completePath)
+	if err != nil {
+		log.Println(logPrefixErrorHere, color.HiRedString("Error while moving \"%s\" to \"%s\": %s", outputFile, completePath, err))
+		return mDownloadStatus(downloadFailedWritingFile, err)
+	}
+
+	finalStatus := finalizeDownload(file, &download{
+		URL:         inputURL,
+		Destination: completePath,
+		Filename:    filename,
+		Size:        size,
+		ContentType: contentType,
+		Hash:        contentHash,
+	}, contentTypeFound, message, fileTime, historyCmd, thisDownloadID, startTime)
+	addDuplicateImage(finalStatus, thisDownloadID, imageHash)
+	return finalStatus
+}
+
+// Sniffs the first 512 bytes the same way downloads are checked
+func getFileContentType(file string) (string, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	head := make([]byte, 512)
+	headLength, err := io.ReadFull(f, head)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return "", err
+	}
+	return http.DetectContentType(head[:headLength]), nil
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+)
+
+// Resolves links from a specific site into direct download links
+type extractor interface {
+	Name() string
+	Match(link string) bool
+	Extract(ctx context.Context, link string, channelID string) ([]*fileItem, error)
+}
+
+type registeredExtractor struct {
+	extractor        extractor
+	enabledByDefault bool
+}
+
+// Order matters, the first extractor to return links wins
+var extractorRegistry []registeredExtractor
+
+func registerExtractor(e extractor, enabledByDefault bool) {
+	extractorRegistry = append(extractorRegistry, registeredExtractor{
+		extractor:        e,
+		enabledByDefault: enabledByDefault,
+	})
+}
+
+func registerExtractors() {
+	// Configured domains take priority over the built-in site support
+	registerExtractor(&externalExtractor{}, true)
+	registerExtractor(&siteExtractor{name: "twitter", routes: []siteExtractorRoute{
+		{regexUrlTwitter.MatchString, func(link string, _ string) (map[string]string, error) { return getTwitterUrls(link) }},
+		{regexUrlTwitterStatus.MatchString, getTwitterStatusUrls},
+	}}, true)
+	registerExtractor(&siteExtractor{name: "instagram", routes: []siteExtractorRoute{
+		{regexUrlInstagram.MatchString, func(link string, _ string) (map[string]string, error) { return getInstagramUrls(link) }},
+	}}, true)
+	registerExtractor(&siteExtractor{name: "facebook", routes: []siteExtractorRoute{
+		{func(link string) bool {
+			return regexUrlFacebookVideo.MatchString(link) || regexUrlFacebookVideoWatch.MatchString(link)
+		}, func(link string, _ string) (map[string]string, error) { return getFacebookVideoUrls(link) }},
+	}}, true)
+	registerExtractor(&siteExtractor{name: "imgur", routes: []siteExtractorRoute{
+		{regexUrlImgurSingle.MatchString, func(link string, _ string) (map[string]string, error) { return getImgurSingleUrls(link) }},
+		{regexUrlImgurAlbum.MatchString, func(link string, _ string) (map[string]string, error) { return getImgurAlbumUrls(link) }},
+	}}, true)
+	registerExtractor(&siteExtractor{name: "streamable", routes: []siteExtractorRoute{
+		{regexUrlStreamable.MatchString, func(link string, _ string) (map[string]string, error) { return getStreamableUrls(link) }},
+	}}, true)
+	registerExtractor(&siteExtractor{name: "gfycat", routes: []siteExtractorRoute{
+		{regexUrlGfycat.MatchString, func(link string, _ string) (map[string]string, error) { return getGfycatUrls(link) }},
+	}}, true)
+	registerExtractor(&siteExtractor{name: "flickr", routes: []siteExtractorRoute{
+		{regexUrlFlickrPhoto.MatchString, func(link string, _ string) (map[string]string, error) { return getFlickrPhotoUrls(link) }},
+		{regexUrlFlickrAlbum.MatchString, func(link string, _ string) (map[string]string, error) { return getFlickrAlbumUrls(link) }},
+		{regexUrlFlickrAlbumShort.MatchString, func(link string, _ string) (map[string]string, error) { return getFlickrAlbumShortUrls(link) }},
+	}}, true)
+	registerExtractor(&siteExtractor{name: "googledrive", routes: []siteExtractorRoute{
+		{regexUrlGoogleDrive.MatchString, func(link string, _ string) (map[string]string, error) { return getGoogleDriveUrls(link) }},
+		{regexUrlGoogleDriveFolder.MatchString, func(link string, _ string) (map[string]string, error) { return getGoogleDriveFolderUrls(link) }},
+	}}, true)
+	registerExtractor(&siteExtractor{name: "tistory", routes: []siteExtractorRoute{
+		{regexUrlTistory.MatchString, func(link string, _ string) (map[string]string, error) { return getTistoryUrls(link) }},
+		{regexUrlTistoryLegacy.MatchString, func(link string, _ string) (map[string]string, error) { return getLegacyTistoryUrls(link) }},
+		// The original project has this as an option,
+		{regexUrlPossibleTistorySite.MatchString, func(link string, _ string) (map[string]string, error) { return getPossibleTistorySiteUrls(link) }},
+	}}, true)
+	registerExtractor(&redditExtractor{}, true)
+	// Matches nearly everything, keep last
+	registerExtractor(&openGraphExtractor{}, false)
+}
+
+// Wraps a failure so every extractor reports errors the same way
+type extractorError struct {
+	Extractor string
+	Link      string
+	Err       error
+}
+
+func (e *extractorError) Error() string {
+	return fmt.Sprintf("%s extractor failed for %s -- %s", e.Extractor, e.Link, e.Err)
+}
+
+// Checks channel settings, extractors can be turned on or off by name
+func isExtractorEnabled(channelConfig configurationChannel, name string, enabledByDefault bool) bool {
+	if channelConfig.DisabledExtractors != nil && stringInSlice(name, *channelConfig.DisabledExtractors) {
+		return false
+	}
+	if channelConfig.EnabledExtractors != nil && stringInSlice(name, *channelConfig.EnabledExtractors) {
+		return true
+	}
+	return enabledByDefault
+}
+
+// Converts the link/filename maps returned by the parse.go functions
+func fileItemsFromLinks(links map[string]string) []*fileItem {
+	var items []*fileItem
+	for link, filename := range links {
+		items = append(items, &fileItem{
+			Link:     link,
+			Filename: filename,
+		})
+	}
+	// Keep a stable order
+	sort.Slice(items, func(i, j int) bool {
+		if items[i].Filename != items[j].Filename {
+			return items[i].Filename < items[j].Filename
+		}
+		return items[i].Link < items[j].Link
+	})
+	return items
+}
+
+// Extractor for sites handled by one or more regex matched functions in parse.go
+type siteExtractor struct {
+	name   string
+	routes []siteExtractorRoute
+}
+
+type siteExtractorRoute struct {
+	match   func(link string) bool
+	extract func(link string, channelID string) (map[string]string, error)
+}
+
+func (e *siteExtractor) Name() string {
+	return e.name
+}
+
+func (e *siteExtractor) Match(link string) bool {
+	for _, route := range e.routes {
+		if route.match(link) {
+			return true
+		}
+	}
+	return false
+}
+
+// Tries each matching route in order, like the original if-chain did
+func (e *siteExtractor) Extract(ctx context.Context, link string, channelID string) ([]*fileItem, error) {
+	var lastErr error
+	for _, route := range e.routes {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		if !route.match(link) {
+			continue
+		}
+		links, err := route.extract(link, channelID)
+		if err != nil {
+			lastErr = err
+		} else if len(links) > 0 {
+			return fileItemsFromLinks(links), nil
+		}
+	}
+	return nil, lastErr
+}
@@ -4,18 +4,24 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/bwmarrin/discordgo"
 	"github.com/fatih/color"
 	"github.com/hako/durafmt"
-	"mvdan.cc/xurls/v2"
 )
 
 type fileItem struct {
-	Link     string
-	Filename string
-	Time     time.Time
+	Link       string
+	SourceLink string // link as posted, before extractors
+	Filename   string
+	Time       time.Time
+	Extractor  string
+	AudioLink  string // separate audio stream to mux in, requires ffmpeg
+	External   bool   // downloaded by an external program rather than directly
+	Index      int    // position among the files of its message, starting at 1
 }
 
 var (
@@ -32,19 +38,56 @@ func messageCreate(s *discordgo.Session, m *discordgo.MessageCreate) {
 }
 
 func messageUpdate(s *discordgo.Session, m *discordgo.MessageUpdate) {
-	if m.EditedTimestamp != discordgo.Timestamp("") {
+	if m.EditedTimestamp != nil {
 		handleMessage(m.Message, true)
 	}
 }
 
+// Why a message shouldn't be downloaded from, empty if it should. Shared by live messages & history.
+func getMessageSkipReason(m *discordgo.Message, channelConfig configurationChannel, bypassUserFilters bool) string {
+	config := getConfig()
+	if !bypassUserFilters {
+		// User Whitelisting
+		if !*channelConfig.UsersAllWhitelisted && channelConfig.UserWhitelist != nil {
+			if !stringInSlice(m.Author.ID, *channelConfig.UserWhitelist) {
+				return "user not being whitelisted"
+			}
+		}
+		// User Blacklisting
+		if channelConfig.UserBlacklist != nil {
+			if stringInSlice(m.Author.ID, *channelConfig.UserBlacklist) {
+				return "user being blacklisted"
+			}
+		}
+	}
+
+	// Skipping
+	canSkip := config.AllowSkipping
+	if channelConfig.OverwriteAllowSkipping != nil {
+		canSkip = *channelConfig.OverwriteAllowSkipping
+	}
+	if canSkip {
+		for _, cmd := range skipCommands {
+			if m.Content == cmd {
+				return "use of skip command"
+			}
+		}
+	}
+	return ""
+}
+
 func handleMessage(m *discordgo.Message, edited bool) {
+	config := getConfig()
 	if !isChannelRegistered(m.ChannelID) {
 		return
 	}
 	channelConfig := getChannelConfig(m.ChannelID)
+	if !edited {
+		setLastSeenMessage(m)
+	}
 
 	// Ignore own messages unless told not to
-	if m.Author.ID == user.ID && !config.ScanOwnMessages {
+	if m.Author.ID == getBotUser().ID && !config.ScanOwnMessages {
 		return
 	}
 	// Ignore if told so by config
@@ -69,52 +112,22 @@ func handleMessage(m *discordgo.Message, edited bool) {
 		log.Println(color.CyanString("Message [%s]: %s", sendLabel, content))
 	}
 
-	// User Whitelisting
-	if !*channelConfig.UsersAllWhitelisted && channelConfig.UserWhitelist != nil {
-		if !stringInSlice(m.Author.ID, *channelConfig.UserWhitelist) {
-			log.Println(color.HiYellowString("Message handling skipped due to user not being whitelisted."))
-			return
-		}
-	}
-	// User Blacklisting
-	if channelConfig.UserBlacklist != nil {
-		if stringInSlice(m.Author.ID, *channelConfig.UserBlacklist) {
-			log.Println(color.HiYellowString("Message handling skipped due to user being blacklisted."))
-			return
-		}
-	}
-
-	// Skipping
-	canSkip := config.AllowSkipping
-	if channelConfig.OverwriteAllowSkipping != nil {
-		canSkip = *channelConfig.OverwriteAllowSkipping
-	}
-	if canSkip {
-		for _, cmd := range skipCommands {
-			if m.Content == cmd {
-				log.Println(color.HiYellowString("Message handling skipped due to use of skip command."))
-				return
-			}
-		}
+	if reason := getMessageSkipReason(m, channelConfig, false); reason != "" {
+		log.Println(color.HiYellowString("Message handling skipped due to %s.", reason))
+		return
 	}
 
-	// Process Files
-	downloadCount := 0
+	// Queue Files
 	files := getFileLinks(m)
 	for _, file := range files {
 		log.Println(color.CyanString("> FILE: " + file.Link))
 
-		status := startDownload(
-			file.Link,
-			file.Filename,
-			channelConfig.Destination,
-			m,
-			file.Time,
-			false,
-		)
-		if status.Status == downloadSuccess {
-			downloadCount++
-		}
+		queueDownload(&downloadJob{
+			File:       file,
+			Path:       channelConfig.Destination,
+			Message:    m,
+			HistoryCmd: false,
+		})
 	}
 
 	// Save All Links to File
@@ -141,37 +154,182 @@ func handleMessage(m *discordgo.Message, edited bool) {
 			}
 		}
 	}
+}
 
-	if downloadCount > 0 {
-		// Filter Duplicate Images
-		if config.FilterDuplicateImages {
-			encodedStore, err := imgStore.GobEncode()
+var (
+	historyCommandActive map[string]string
+)
+
+// How far a channel's history has been cataloged, stored so a stopped run can pick up where it left off.
+// Runs walk from the newest message back, messages posted since are caught up on from NewestID.
+type historyCheckpoint struct {
+	ChannelID string
+	NewestID  string // newest message processed
+	OldestID  string // oldest message processed
+	Complete  bool   // reached the start of the channel
+	Updated   time.Time
+}
+
+// Limits a history run to a window of messages, bounds are message IDs & exclusive.
+// Bounded runs leave the channel's checkpoint alone.
+type historyOptions struct {
+	Before   string
+	After    string
+	AllUsers bool // ignore the channel's user whitelist & blacklist
+}
+
+func (options historyOptions) isBounded() bool {
+	return options.Before != "" || options.After != ""
+}
+
+func (options historyOptions) describe() string {
+	var parts []string
+	if options.After != "" {
+		parts = append(parts, "after "+snowflakeDescription(options.After))
+	}
+	if options.Before != "" {
+		parts = append(parts, "before "+snowflakeDescription(options.Before))
+	}
+	return strings.Join(parts, " and ")
+}
+
+// Discord's epoch, the first second of 2015, in milliseconds
+const discordEpoch = 1420070400000
+
+// Turns a time into the lowest possible message ID for it, so messages can be requested by date
+func timeToSnowflake(t time.Time) string {
+	ms := t.UnixNano()/int64(time.Millisecond) - discordEpoch
+	if ms < 0 {
+		ms = 0
+	}
+	return strconv.FormatUint(uint64(ms)<<22, 10)
+}
+
+func snowflakeToTime(id string) time.Time {
+	number, _ := strconv.ParseUint(id, 10, 64)
+	return time.Unix(0, (int64(number>>22)+discordEpoch)*int64(time.Millisecond))
+}
+
+func snowflakeDescription(id string) string {
+	return fmt.Sprintf("``%s`` _(%s)_", id, snowflakeToTime(id).Format("2006-01-02 15:04:05"))
+}
+
+// Accepts a message ID or a date like the export command does
+func parseHistoryBound(value string, endOfDay bool) (string, error) {
+	if _, err := strconv.ParseUint(value, 10, 64); err == nil {
+		return value, nil
+	}
+	t, err := parseExportDate(value, endOfDay)
+	if err != nil {
+		return "", fmt.Errorf("invalid message ID or date \"%s\"", value)
+	}
+	return timeToSnowflake(t), nil
+}
+
+// Message IDs are snowflakes, compared as numbers
+func isMessageIDAfter(id string, than string) bool {
+	idNumber, _ := strconv.ParseUint(id, 10, 64)
+	thanNumber, _ := strconv.ParseUint(than, 10, 64)
+	return idNumber > thanNumber
+}
+
+// Reads history command arguments: "cancel" or "restart", comma separated channel IDs for admin channels
+// and range bounds. since/after are the lower bound, before/until the upper, each a date or message ID.
+func parseHistoryArgs(args []string) (string, []string, historyOptions, error) {
+	var action string
+	var channels []string
+	var options historyOptions
+	for _, arg := range args {
+		arg = strings.TrimSpace(arg)
+		lowerArg := strings.ToLower(arg)
+		switch {
+		case arg == "":
+		case lowerArg == "cancel" || lowerArg == "restart":
+			action = lowerArg
+		case lowerArg == "allusers":
+			options.AllUsers = true
+		case strings.Contains(arg, ":"):
+			i := strings.Index(arg, ":")
+			key, value := strings.ToLower(arg[:i]), arg[i+1:]
+			var err error
+			switch key {
+			case "since", "after":
+				options.After, err = parseHistoryBound(value, false)
+			case "before", "until":
+				options.Before, err = parseHistoryBound(value, key == "until")
+			default:
+				err = fmt.Errorf("unknown option \"%s\"", key)
+			}
 			if err != nil {
-				log.Println(color.HiRedString("Failed to encode imgStore:\t%s"))
-			} else {
-				f, err := os.OpenFile(imgStorePath, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0755)
-				if err != nil {
-					log.Println(color.HiRedString("Failed to open imgStore file:\t%s"))
-				}
-				_, err = f.Write(encodedStore)
-				if err != nil {
-					log.Println(color.HiRedString("Failed to update imgStore file:\t%s"))
-				}
-				err = f.Close()
-				if err != nil {
-					log.Println(color.HiRedString("Failed to close imgStore file:\t%s"))
+				return action, channels, options, err
+			}
+		default:
+			for _, channelValue := range strings.Split(arg, ",") {
+				if channelValue = strings.TrimSpace(channelValue); channelValue != "" {
+					channels = append(channels, channelValue)
 				}
 			}
 		}
 	}
+	if options.Before != "" && options.After != "" && !isMessageIDAfter(options.Before, options.After) {
+		return action, channels, options, fmt.Errorf("the end of the range is before its start")
+	}
+	return action, channels, options, nil
 }
 
-var (
-	historyCommandActive map[string]string
-)
+// Queues everything in a batch of messages the same way live messages are, the returned channels receive the results
+func handleHistoryMessages(messages []*discordgo.Message, channelConfig configurationChannel, options historyOptions) []<-chan downloadStatusStruct {
+	config := getConfig()
+	botUserID := getBotUser().ID
+	// Messages from the API don't say which server they're in
+	guildID := ""
+	if len(messages) > 0 {
+		if channel, err := bot.State.Channel(messages[0].ChannelID); err == nil {
+			guildID = channel.GuildID
+		}
+	}
+
+	var queued []<-chan downloadStatusStruct
+	for _, message := range messages {
+		if message.GuildID == "" {
+			message.GuildID = guildID
+		}
+		// Ignore own messages unless told not to
+		if message.Author.ID == botUserID && !config.ScanOwnMessages {
+			continue
+		}
+		if reason := getMessageSkipReason(message, channelConfig, options.AllUsers); reason != "" {
+			if config.DebugOutput {
+				log.Println(logPrefixDebug, color.YellowString("[handleHistory] Skipped message %s due to %s.", message.ID, reason))
+			}
+			continue
+		}
+		for _, file := range getFileLinks(message) {
+			queued = append(queued, queueDownload(&downloadJob{
+				File:       file,
+				Path:       channelConfig.Destination,
+				Message:    message,
+				HistoryCmd: true,
+			}))
+		}
+	}
+	return queued
+}
+
+// Message IDs are snowflakes, a longer ID is always a later one
+func getNewestMessageID(messages []*discordgo.Message) string {
+	newest := ""
+	for _, message := range messages {
+		if len(message.ID) > len(newest) || (len(message.ID) == len(newest) && message.ID > newest) {
+			newest = message.ID
+		}
+	}
+	return newest
+}
 
-func handleHistory(commandingMessage *discordgo.Message, commandingChannelID string, subjectChannelID string) int {
+func handleHistory(commandingMessage *discordgo.Message, commandingChannelID string, subjectChannelID string, options historyOptions) int {
 	historyCommandActive[subjectChannelID] = "downloading"
+	defer delete(historyCommandActive, subjectChannelID)
 
 	i := 0
 
@@ -180,140 +338,232 @@ func handleHistory(commandingMessage *discordgo.Message, commandingChannelID str
 
 		historyStartTime := time.Now()
 
-		message, err := replyEmbed(commandingMessage, "Command — History", "Starting to catalog channel history, please wait...")
+		var checkpoint *historyCheckpoint
+		if !options.isBounded() {
+			checkpoint = dbFindHistoryCheckpoint(subjectChannelID)
+		}
+		startContent := "Starting to catalog channel history, please wait..."
+		if options.isBounded() {
+			startContent = fmt.Sprintf("Starting to catalog channel history %s, please wait...", options.describe())
+		} else if checkpoint != nil {
+			startContent = fmt.Sprintf("Resuming channel history from where it was left off %s ago, please wait...\n_Use ``history restart`` to start over._",
+				durafmt.ParseShort(time.Since(checkpoint.Updated)).String())
+		}
+
+		message, err := replyEmbed(commandingMessage, "Command — History", startContent)
 		if err != nil {
 			log.Println(color.HiRedString("[handleHistory] Failed to send command embed message (requested by %s):\t%s", getUserIdentifier(*commandingMessage.Author), err))
 		}
 		log.Println(color.HiCyanString("[handleHistory] %s began cataloging history for %s", getUserIdentifier(*commandingMessage.Author), subjectChannelID))
 
-		lastBefore := ""
-		var lastBeforeTime time.Time
-	MessageRequestingLoop:
-		for true {
-			if lastBeforeTime != (time.Time{}) {
-				log.Println(color.CyanString("[handleHistory] Requesting 100 more messages, %d cataloged, (before %s)",
-					i, lastBeforeTime))
-				// Status update
-				if message != nil {
-					content := fmt.Sprintf("``%s:`` %d files cataloged\n_Requesting more messages, please wait..._",
-						durafmt.ParseShort(time.Since(historyStartTime)).String(), i)
-					message, err = bot.ChannelMessageEditComplex(&discordgo.MessageEdit{
-						ID:      message.ID,
-						Channel: message.ChannelID,
-						Embed:   buildEmbed(message.ChannelID, "Command — History", content),
-					})
-					// Edit failure
+		updateStatus := func(content string) {
+			if message != nil {
+				message, err = bot.ChannelMessageEditComplex(&discordgo.MessageEdit{
+					ID:      message.ID,
+					Channel: message.ChannelID,
+					Embed:   buildEmbed(message.ChannelID, "Command — History", content),
+				})
+				// Edit failure
+				if err != nil {
+					log.Println(color.RedString("[handleHistory] Failed to edit status message, sending new one:\t%s", err))
+					message, err = replyEmbed(commandingMessage, "Command — History", content)
 					if err != nil {
-						log.Println(color.RedString("[handleHistory] Failed to edit status message, sending new one:\t%s", err))
-						message, err = replyEmbed(message, "Command — History", content)
-						if err != nil {
-							log.Println(color.HiRedString("[handleHistory] Failed to send replacement status message:\t%s", err))
-						}
+						log.Println(color.HiRedString("[handleHistory] Failed to send replacement status message:\t%s", err))
 					}
-				} else {
-					log.Println(color.HiRedString("[handleHistory] Tried to edit status message but it doesn't exist."))
 				}
+			} else {
+				log.Println(color.HiRedString("[handleHistory] Tried to edit status message but it doesn't exist."))
 			}
-			messages, err := bot.ChannelMessages(subjectChannelID, 100, lastBefore, "", "")
-			if err == nil {
-				if len(messages) <= 0 {
-					delete(historyCommandActive, subjectChannelID)
+		}
+
+		// The channel itself, then any threads & forum posts in it, each keeping its own checkpoint
+		targets := []string{subjectChannelID}
+		var threads []string
+		if getThreadParentID(subjectChannelID) == "" && isIncludingThreads(subjectChannelID, channelConfig) {
+			threads = getChannelThreads(subjectChannelID)
+			// Forum channels only hold posts
+			if channel, err := getChannel(subjectChannelID); err == nil && channel.Type == discordgo.ChannelTypeGuildForum {
+				targets = nil
+			}
+			targets = append(targets, threads...)
+		}
+		complete := true
+		cancelled := false
+		batches := 0
+		threadNumber := 0
+	TargetLoop:
+		for _, targetChannelID := range targets {
+			targetDescription := ""
+			if targetChannelID != subjectChannelID {
+				threadNumber++
+				targetDescription = fmt.Sprintf(" in thread %d of %d", threadNumber, len(threads))
+			}
+
+			checkpoint = nil
+			if !options.isBounded() {
+				checkpoint = dbFindHistoryCheckpoint(targetChannelID)
+			}
+			if options.isBounded() {
+				// Works through the range like a fresh run, without saving.
+				// Pages forward from the start of the range when there is one, otherwise back from its end.
+				checkpoint = &historyCheckpoint{ChannelID: targetChannelID, NewestID: options.After, OldestID: options.Before}
+			} else if checkpoint == nil {
+				checkpoint = &historyCheckpoint{ChannelID: targetChannelID}
+			}
+
+			// Newer messages first when resuming, then carry on back towards the start of the channel
+			catchingUp := checkpoint.NewestID != ""
+			lastBefore := checkpoint.OldestID
+			var lastBeforeTime time.Time
+		MessageRequestingLoop:
+			for true {
+				if !catchingUp && checkpoint.Complete {
 					break MessageRequestingLoop
 				}
-				lastBefore = messages[len(messages)-1].ID
-				lastBeforeTime, err = messages[len(messages)-1].Timestamp.Parse()
+				if catchingUp {
+					log.Println(color.CyanString("[handleHistory] Requesting 100 more messages%s, %d cataloged, (after %s)",
+						targetDescription, i, checkpoint.NewestID))
+				} else if lastBefore != "" {
+					before := lastBefore
+					if !lastBeforeTime.IsZero() {
+						before = lastBeforeTime.String()
+					}
+					log.Println(color.CyanString("[handleHistory] Requesting 100 more messages%s, %d cataloged, (before %s)",
+						targetDescription, i, before))
+				}
+				// Status update
+				if batches > 0 {
+					updateStatus(fmt.Sprintf("``%s:`` %d files cataloged\n_Requesting more messages%s, please wait..._",
+						durafmt.ParseShort(time.Since(historyStartTime)).String(), i, targetDescription))
+				}
+				batches++
+
+				var messages []*discordgo.Message
+				if catchingUp {
+					messages, err = bot.ChannelMessages(targetChannelID, 100, "", checkpoint.NewestID, "")
+				} else {
+					messages, err = bot.ChannelMessages(targetChannelID, 100, lastBefore, "", "")
+				}
 				if err != nil {
-					log.Println(color.RedString("[handleHistory] Failed to fetch message timestamp:\t%s", err))
+					// Error requesting messages
+					_, err = replyEmbed(message, "Command — History", fmt.Sprintf("Encountered an error requesting messages%s: %s", targetDescription, err.Error()))
+					if err != nil {
+						log.Println(color.HiRedString("[handleHistory] Failed to send error message:\t%s", err))
+					}
+					log.Println(color.HiRedString("[handleHistory] Error requesting messages:\t%s", err))
+					break MessageRequestingLoop
+				}
+				if len(messages) <= 0 {
+					if catchingUp && options.After != "" {
+						checkpoint.Complete = true
+						break MessageRequestingLoop
+					}
+					if catchingUp {
+						catchingUp = false
+						continue
+					}
+					checkpoint.Complete = true
+					if !options.isBounded() {
+						dbSaveHistoryCheckpoint(checkpoint)
+					}
+					break MessageRequestingLoop
+				}
+				if historyCommandActive[subjectChannelID] == "cancel" {
+					cancelled = true
+					break MessageRequestingLoop
 				}
-				for _, message := range messages {
-					fileTime := time.Now()
-					if message.Timestamp != "" {
-						fileTime, err = message.Timestamp.Parse()
-						if err != nil {
-							log.Println(color.RedString("[handleHistory] Failed to parse message timestamp:\t%s", err))
+				// Stop at the end of the range when paging forward through it
+				reachedEnd := false
+				if catchingUp && options.After != "" && options.Before != "" {
+					var inRange []*discordgo.Message
+					for _, message := range messages {
+						if isMessageIDAfter(options.Before, message.ID) {
+							inRange = append(inRange, message)
+						} else {
+							reachedEnd = true
 						}
 					}
-					if historyCommandActive[message.ChannelID] == "cancel" {
-						delete(historyCommandActive, message.ChannelID)
+					if len(inRange) == 0 {
+						checkpoint.Complete = true
 						break MessageRequestingLoop
 					}
-					for _, iAttachment := range message.Attachments {
-						if len(dbFindDownloadByURL(iAttachment.URL)) == 0 {
-							download := startDownload(
-								iAttachment.URL,
-								iAttachment.Filename,
-								channelConfig.Destination,
-								message,
-								fileTime,
-								true,
-							)
-							if download.Status == downloadSuccess {
-								i++
-							}
-						}
+					messages = inRange
+				}
+
+				queued := handleHistoryMessages(messages, channelConfig, options)
+
+				// Queued downloads are kept in the database, so the checkpoint can move on before they finish
+				if catchingUp {
+					checkpoint.NewestID = getNewestMessageID(messages)
+				} else {
+					if checkpoint.NewestID == "" {
+						checkpoint.NewestID = getNewestMessageID(messages)
 					}
-					foundUrls := xurls.Strict().FindAllString(message.Content, -1)
-					for _, iFoundUrl := range foundUrls {
-						links := getDownloadLinks(iFoundUrl, subjectChannelID)
-						for link, filename := range links {
-							if len(dbFindDownloadByURL(link)) == 0 {
-								download := startDownload(
-									link,
-									filename,
-									channelConfig.Destination,
-									message,
-									fileTime,
-									true,
-								)
-								if download.Status == downloadSuccess {
-									i++
-								}
-							}
-						}
+					lastBefore = messages[len(messages)-1].ID
+					checkpoint.OldestID = lastBefore
+					lastBeforeTime = messages[len(messages)-1].Timestamp
+				}
+				if !options.isBounded() {
+					dbSaveHistoryCheckpoint(checkpoint)
+				}
+
+				// Wait for this batch before requesting more
+				for _, done := range queued {
+					switch status := <-done; status.Status {
+					case downloadSuccess:
+						i++
+					case downloadSkippedQueueStopped:
+						cancelled = true
 					}
 				}
-			} else {
-				// Error requesting messages
-				_, err = replyEmbed(message, "Command — History", fmt.Sprintf("Encountered an error requesting messages: %s", err.Error()))
-				if err != nil {
-					log.Println(color.HiRedString("[handleHistory] Failed to send error message:\t%s", err))
+				if cancelled {
+					break MessageRequestingLoop
 				}
-				log.Println(color.HiRedString("[handleHistory] Error requesting messages:\t%s", err))
-				delete(historyCommandActive, subjectChannelID)
-				break MessageRequestingLoop
+				if reachedEnd {
+					checkpoint.Complete = true
+					break MessageRequestingLoop
+				}
+			}
+			if !checkpoint.Complete {
+				complete = false
+			}
+			if cancelled {
+				break TargetLoop
 			}
 		}
 
 		// Final status update
-		if message != nil {
-			contentFinal := fmt.Sprintf("``%s:`` **%s total files saved!**\n\nFinished cataloging history for ``%s``\n\n_Duration was %s_",
-				durafmt.ParseShort(time.Since(historyStartTime)).String(),
-				formatNumber(int64(i)),
-				commandingMessage.ChannelID,
-				durafmt.Parse(time.Since(historyStartTime)).String(),
-			)
-			message, err = bot.ChannelMessageEditComplex(&discordgo.MessageEdit{
-				ID:      message.ID,
-				Channel: message.ChannelID,
-				Embed:   buildEmbed(message.ID, "Command — History", contentFinal),
-			})
-			// Edit failure
-			if err != nil {
-				log.Println(color.RedString("[handleHistory] Failed to edit status message, sending new one:\t%s", err))
-				message, err = replyEmbed(message, "Command — History", contentFinal)
-				if err != nil {
-					log.Println(color.HiRedString("[handleHistory] Failed to send replacement status message:\t%s", err))
-				}
-			}
-		} else {
-			log.Println(color.HiRedString("[handleHistory] Tried to edit status message but it doesn't exist."))
+		contentFinal := fmt.Sprintf("``%s:`` **%s total files saved!**\n\nFinished cataloging history for ``%s``",
+			durafmt.ParseShort(time.Since(historyStartTime)).String(),
+			formatNumber(int64(i)),
+			subjectChannelID,
+		)
+		if len(threads) > 0 {
+			contentFinal += fmt.Sprintf(" and %s thread(s) in it", formatNumber(int64(len(threads))))
+		}
+		contentFinal += fmt.Sprintf("\n\n_Duration was %s_", durafmt.Parse(time.Since(historyStartTime)).String())
+		if options.isBounded() {
+			contentFinal += fmt.Sprintf("\n\n_Messages %s_", options.describe())
+		} else if !complete {
+			contentFinal += "\n\n_Stopped before reaching the start of the channel, running ``history`` again will resume from here._"
 		}
+		updateStatus(contentFinal)
 
 		// Final log
 		log.Println(color.HiCyanString("[handleHistory] Finished cataloging history for %s (requested by %s): %d files...",
-			commandingMessage.ChannelID, getUserIdentifier(*commandingMessage.Author), i),
+			subjectChannelID, getUserIdentifier(*commandingMessage.Author), i),
 		)
 	}
 
 	return i
 }
+
+// Forgets where history left off in a channel and the threads in it
+func deleteHistoryCheckpoints(channelID string) {
+	dbDeleteHistoryCheckpoint(channelID)
+	if getThreadParentID(channelID) == "" && isIncludingThreads(channelID, getChannelConfig(channelID)) {
+		for _, threadID := range getChannelThreads(channelID) {
+			dbDeleteHistoryCheckpoint(threadID)
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSnowflakeTime(t *testing.T) {
+	tests := []struct {
+		name string
+		time time.Time
+		id   string
+	}{
+		{"discord epoch", time.Date(2015, 1, 1, 0, 0, 0, 0, time.UTC), "0"},
+		{"documented example", time.Unix(0, 1462015105796*int64(time.Millisecond)), "175928847298985984"},
+		{"start of 2021", time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC), "794354201395200000"},
+		{"before the epoch", time.Date(2010, 1, 1, 0, 0, 0, 0, time.UTC), "0"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := timeToSnowflake(test.time); got != test.id {
+				t.Errorf("timeToSnowflake(%s) = %s, want %s", test.time, got, test.id)
+			}
+		})
+	}
+
+	// Message IDs carry more than the time, only the milliseconds count
+	if got, want := snowflakeToTime("175928847299117063"), time.Unix(0, 1462015105796*int64(time.Millisecond)); !got.Equal(want) {
+		t.Errorf("snowflakeToTime = %s, want %s", got, want)
+	}
+	now := time.Now().Truncate(time.Millisecond)
+	if got := snowflakeToTime(timeToSnowflake(now)); !got.Equal(now) {
+		t.Errorf("snowflakeToTime(timeToSnowflake(%s)) = %s", now, got)
+	}
+}
+
+func TestIsMessageIDAfter(t *testing.T) {
+	tests := []struct {
+		id   string
+		than string
+		want bool
+	}{
+		{"2", "1", true},
+		{"1", "2", false},
+		{"5", "5", false},
+		{"10", "9", true}, // compared as numbers, not strings
+		{"175928847299117063", "99999999999999999", true},
+		{"1", "", true},
+		{"", "1", false},
+	}
+	for _, test := range tests {
+		if got := isMessageIDAfter(test.id, test.than); got != test.want {
+			t.Errorf("isMessageIDAfter(%q, %q) = %v, want %v", test.id, test.than, got, test.want)
+		}
+	}
+}
+
+func TestParseHistoryArgs(t *testing.T) {
+	tests := []struct {
+		name     string
+		args     []string
+		action   string
+		channels []string
+		options  historyOptions
+		wantErr  bool
+	}{
+		{"nothing", nil, "", nil, historyOptions{}, false},
+		{"cancel", []string{"Cancel"}, "cancel", nil, historyOptions{}, false},
+		{"restart with channels", []string{"restart", "123, 456", "789"}, "restart", []string{"123", "456", "789"}, historyOptions{}, false},
+		{"all users", []string{"allusers"}, "", nil, historyOptions{AllUsers: true}, false},
+		{"message ID bounds", []string{"after:100", "before:200"}, "", nil, historyOptions{After: "100", Before: "200"}, false},
+		{"date bounds", []string{"since:2021-01-01T00:00:00Z", "until:2021-02-01T00:00:00Z"}, "", nil,
+			historyOptions{After: "794354201395200000", Before: "805588225228800000"}, false},
+		{"key case", []string{"SINCE:100"}, "", nil, historyOptions{After: "100"}, false},
+		{"unknown option", []string{"during:100"}, "", nil, historyOptions{}, true},
+		{"invalid bound", []string{"before:yesterday"}, "", nil, historyOptions{}, true},
+		{"reversed range", []string{"after:200", "before:100"}, "", nil, historyOptions{After: "200", Before: "100"}, true},
+		{"empty range", []string{"after:100", "before:100"}, "", nil, historyOptions{After: "100", Before: "100"}, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			action, channels, options, err := parseHistoryArgs(test.args)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("error = %v, want error %v", err, test.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if action != test.action {
+				t.Errorf("action = %q, want %q", action, test.action)
+			}
+			if !reflect.DeepEqual(channels, test.channels) {
+				t.Errorf("channels = %q, want %q", channels, test.channels)
+			}
+			if options != test.options {
+				t.Errorf("options = %+v, want %+v", options, test.options)
+			}
+		})
+	}
+
+	// Plain dates are local days, until includes the whole day
+	_, _, options, err := parseHistoryArgs([]string{"since:2021-01-01", "until:2021-01-01"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	day := time.Date(2021, 1, 1, 0, 0, 0, 0, time.Local)
+	if want := timeToSnowflake(day); options.After != want {
+		t.Errorf("since = %s, want %s", options.After, want)
+	}
+	if want := timeToSnowflake(day.AddDate(0, 0, 1)); options.Before != want {
+		t.Errorf("until = %s, want %s", options.Before, want)
+	}
+}
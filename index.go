@@ -0,0 +1,369 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"image"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unicode"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/fatih/color"
+	"github.com/hako/durafmt"
+	"github.com/rivo/duplo"
+)
+
+const indexExtractorName = "index"
+
+var (
+	indexRunning      bool
+	indexRunningMutex sync.Mutex
+)
+
+type indexOptions struct {
+	Folder    string
+	ChannelID string // channel the files are recorded under, so that channel skips their links
+	LinksFile string // list of links to match files against, one per line
+}
+
+type indexResult struct {
+	ChannelID string // channel the files were recorded under, given or found from the folder
+	Scanned   int
+	Indexed   int
+	Matched   int // files matched to a link from the list
+	Known     int // already in the database
+	Images    int // added to the duplicate image store
+	Failures  int
+}
+
+// Marks an index as running, false if one already is
+func startIndex() bool {
+	indexRunningMutex.Lock()
+	defer indexRunningMutex.Unlock()
+	if indexRunning {
+		return false
+	}
+	indexRunning = true
+	return true
+}
+
+func stopIndex() {
+	indexRunningMutex.Lock()
+	indexRunning = false
+	indexRunningMutex.Unlock()
+}
+
+// Reads a list of links like SaveAllLinksToFile writes, keyed by the lowercase filename in each link
+func readIndexLinks(path string) (map[string][]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	links := make(map[string][]string)
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		link := strings.TrimSpace(scanner.Text())
+		if link == "" {
+			continue
+		}
+		// Saved names may or may not have been unescaped
+		names := []string{filenameFromURL(link)}
+		if unescaped, err := url.PathUnescape(names[0]); err == nil && unescaped != names[0] {
+			names = append(names, unescaped)
+		}
+		for _, name := range names {
+			if filepathExtension(name) == "" {
+				continue
+			}
+			name = strings.ToLower(name)
+			if !stringInSlice(link, links[name]) {
+				links[name] = append(links[name], link)
+			}
+		}
+	}
+	return links, scanner.Err()
+}
+
+// Finds the link whose filename the file name ends with, filename templates usually put a date or
+// other details in front. The longest match wins.
+func matchIndexLink(name string, links map[string][]string) string {
+	name = strings.ToLower(name)
+	for i := range name {
+		if i > 0 {
+			previous := rune(name[i-1])
+			if unicode.IsLetter(previous) || unicode.IsDigit(previous) {
+				continue
+			}
+		}
+		if matches, ok := links[name[i:]]; ok {
+			return matches[0]
+		}
+	}
+	return ""
+}
+
+// Adds an image file to the duplicate image store, same limits as downloads
+func addIndexedImage(path string, extension string, size int64) bool {
+	config := getConfig()
+	if extension == ".gif" || extension == ".webp" || size > config.FilterDuplicateImagesMaxSize*1024*1024 {
+		return false
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer file.Close()
+	img, _, err := image.Decode(file)
+	if err != nil {
+		return false
+	}
+	hash, _ := duplo.CreateHash(img)
+	imgStoreMutex.Lock()
+	imgStore.Add(path, hash)
+	imgStoreMutex.Unlock()
+	return true
+}
+
+// The channel whose destination holds the folder, if only one channel's does.
+// Server & category entries cover more than one channel, so they never count.
+func getIndexChannel(folder string) string {
+	config := getConfig()
+	folder, err := filepath.Abs(folder)
+	if err != nil {
+		return ""
+	}
+	channelID := ""
+	for _, channel := range config.Channels {
+		destination, err := filepath.Abs(channel.Destination)
+		if channel.Destination == "" || err != nil {
+			continue
+		}
+		if folder != destination && !strings.HasPrefix(folder, destination+string(filepath.Separator)) {
+			continue
+		}
+		entryChannelID := channel.ChannelID
+		if channel.ChannelIDs != nil && len(*channel.ChannelIDs) == 1 {
+			entryChannelID = (*channel.ChannelIDs)[0]
+		}
+		if entryChannelID == "" || (channelID != "" && channelID != entryChannelID) {
+			return ""
+		}
+		channelID = entryChannelID
+	}
+	return channelID
+}
+
+// Records every file under a folder as downloaded, so dedup & history know about archives from before the bot
+func indexFolder(options indexOptions, progress func(result *indexResult)) (*indexResult, error) {
+	logPrefixHere := color.CyanString("[indexFolder]")
+	if info, err := os.Stat(options.Folder); err != nil {
+		return nil, err
+	} else if !info.IsDir() {
+		return nil, fmt.Errorf("\"%s\" is not a folder", options.Folder)
+	}
+
+	if options.ChannelID == "" {
+		options.ChannelID = getIndexChannel(options.Folder)
+	}
+
+	var links map[string][]string
+	if options.LinksFile != "" {
+		var err error
+		if links, err = readIndexLinks(options.LinksFile); err != nil {
+			return nil, fmt.Errorf("unable to read link list: %s", err)
+		}
+	}
+	known, err := getRecordedDestinations()
+	if err != nil {
+		return nil, err
+	}
+
+	result := &indexResult{ChannelID: options.ChannelID}
+	lastProgress := time.Now()
+	err = filepath.Walk(options.Folder, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			log.Println(logPrefixHere, color.HiRedString("Unable to read \"%s\":\t%s", path, err))
+			result.Failures++
+			return nil
+		}
+		if info.IsDir() {
+			if strings.HasPrefix(info.Name(), ".external-") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !info.Mode().IsRegular() || isDownloadWorkFile(path) {
+			return nil
+		}
+		if progress != nil && time.Since(lastProgress) > 5*time.Second {
+			progress(result)
+			lastProgress = time.Now()
+		}
+		result.Scanned++
+
+		absolute, err := filepath.Abs(path)
+		if err != nil {
+			result.Failures++
+			return nil
+		}
+		if known[absolute] {
+			result.Known++
+			return nil
+		}
+
+		hash, size, err := getFileHash(path)
+		if err != nil {
+			log.Println(logPrefixHere, color.HiRedString("Unable to hash \"%s\":\t%s", path, err))
+			result.Failures++
+			return nil
+		}
+		contentType, _ := getFileContentType(path)
+
+		record := &download{
+			URL:         (&url.URL{Scheme: "file", Path: filepath.ToSlash(absolute)}).String(),
+			Time:        info.ModTime(),
+			Destination: path,
+			Filename:    info.Name(),
+			ChannelID:   options.ChannelID,
+			Size:        size,
+			ContentType: contentType,
+			Hash:        hash,
+			Extractor:   indexExtractorName,
+		}
+		if link := matchIndexLink(info.Name(), links); link != "" {
+			record.URL = link
+			result.Matched++
+		}
+		record.SourceURL = record.URL
+		// Later copies of the same content are recorded as duplicates of the first
+		if original := findOriginalDownload(record); original != nil {
+			record.DuplicateOf = original.ID
+			if original.DuplicateOf != 0 {
+				record.DuplicateOf = original.DuplicateOf
+			}
+			record.DuplicatePolicy = duplicatePolicySave
+		}
+		if err := dbInsertDownload(record); err != nil {
+			log.Println(logPrefixHere, color.HiRedString("Unable to record \"%s\":\t%s", path, err))
+			result.Failures++
+			return nil
+		}
+		known[absolute] = true
+		result.Indexed++
+
+		if imgStore != nil && strings.HasPrefix(contentType, "image/") {
+			if addIndexedImage(path, strings.ToLower(filepath.Ext(path)), size) {
+				result.Images++
+			}
+		}
+		return nil
+	})
+	if result.Images > 0 {
+		saveImgStore()
+	}
+	return result, err
+}
+
+func (result *indexResult) summary(startTime time.Time, options indexOptions) string {
+	content := fmt.Sprintf("``%s:`` **Indexed %s file(s)** from ``%s``\n\n"+
+		"• **Files Scanned —** %s\n"+
+		"• **Already in Database —** %s\n",
+		durafmt.ParseShort(time.Since(startTime)).String(),
+		formatNumber(int64(result.Indexed)), options.Folder,
+		formatNumber(int64(result.Scanned)),
+		formatNumber(int64(result.Known)),
+	)
+	if options.LinksFile != "" {
+		content += fmt.Sprintf("• **Matched to Links —** %s\n", formatNumber(int64(result.Matched)))
+	}
+	if imgStore != nil {
+		content += fmt.Sprintf("• **Added to Duplicate Image Filter —** %s\n", formatNumber(int64(result.Images)))
+	}
+	if result.Failures > 0 {
+		content += fmt.Sprintf("• **Failed —** %s _(see log)_\n", formatNumber(int64(result.Failures)))
+	}
+	if result.ChannelID == "" {
+		content += "\n_No single channel's destination holds this folder, so the files aren't recorded under a channel. " +
+			"Folders of ``channels`` lists, servers & categories need ``channel:<id>``._"
+	}
+	return content
+}
+
+// Runs an index for the index command, keeping a status embed up to date like history does
+func handleIndex(commandingMessage *discordgo.Message, options indexOptions) {
+	logPrefixHere := color.CyanString("[handleIndex]")
+	indexStartTime := time.Now()
+
+	message, err := replyEmbed(commandingMessage, "Command — Index", "Indexing existing files, please wait...")
+	if err != nil {
+		log.Println(logPrefixHere, color.HiRedString("Failed to send command embed message (requested by %s):\t%s", getUserIdentifier(*commandingMessage.Author), err))
+	}
+	log.Println(logPrefixHere, color.HiCyanString("%s began indexing \"%s\"", getUserIdentifier(*commandingMessage.Author), options.Folder))
+
+	updateStatus := func(content string) {
+		if message == nil {
+			log.Println(logPrefixHere, color.HiRedString("Tried to edit status message but it doesn't exist."))
+			return
+		}
+		edited, err := bot.ChannelMessageEditComplex(&discordgo.MessageEdit{
+			ID:      message.ID,
+			Channel: message.ChannelID,
+			Embed:   buildEmbed(message.ChannelID, "Command — Index", content),
+		})
+		if err != nil {
+			log.Println(logPrefixHere, color.RedString("Failed to edit status message, sending new one:\t%s", err))
+			edited, err = replyEmbed(commandingMessage, "Command — Index", content)
+			if err != nil {
+				log.Println(logPrefixHere, color.HiRedString("Failed to send replacement status message:\t%s", err))
+			}
+		}
+		message = edited
+	}
+
+	result, err := indexFolder(options, func(result *indexResult) {
+		updateStatus(fmt.Sprintf("``%s:`` %s file(s) scanned, %s indexed\n_Still indexing, please wait..._",
+			durafmt.ParseShort(time.Since(indexStartTime)).String(),
+			formatNumber(int64(result.Scanned)), formatNumber(int64(result.Indexed))))
+	})
+	if err != nil {
+		log.Println(logPrefixHere, color.HiRedString("Indexing failed:\t%s", err))
+		updateStatus(fmt.Sprintf("Indexing failed: %s", err))
+		return
+	}
+	atomic.AddInt64(&cachedDownloadID, int64(result.Indexed))
+	updateStatus(result.summary(indexStartTime, options))
+
+	log.Println(logPrefixHere, color.HiCyanString("Finished indexing \"%s\" (requested by %s): %d of %d file(s) indexed, %d matched to links",
+		options.Folder, getUserIdentifier(*commandingMessage.Author), result.Indexed, result.Scanned, result.Matched))
+}
+
+// Reads command arguments like "<folder> channel:<id> links:<path>", the folder may contain spaces
+func parseIndexArgs(args []string) (indexOptions, error) {
+	var options indexOptions
+	var folder []string
+	for _, arg := range args {
+		switch {
+		case strings.HasPrefix(strings.ToLower(arg), "channel:"):
+			options.ChannelID = arg[len("channel:"):]
+		case strings.HasPrefix(strings.ToLower(arg), "links:"):
+			options.LinksFile = arg[len("links:"):]
+		default:
+			folder = append(folder, arg)
+		}
+	}
+	options.Folder = strings.TrimSpace(strings.Join(folder, " "))
+	if options.Folder == "" {
+		return options, fmt.Errorf("please enter a folder to index")
+	}
+	return options, nil
+}
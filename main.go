@@ -9,12 +9,13 @@ import (
 	"net/url"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"strings"
+	"sync/atomic"
 	"syscall"
 	"time"
 
 	"github.com/ChimeraCoder/anaconda"
-	"github.com/HouzuoGuo/tiedot/db"
 	"github.com/Necroforger/dgrouter/exrouter"
 	"github.com/bwmarrin/discordgo"
 	"github.com/fatih/color"
@@ -26,16 +27,16 @@ import (
 
 var (
 	bot      *discordgo.Session
-	user     *discordgo.User
-	myDB     *db.DB
+	botUser  atomic.Pointer[discordgo.User]
+	myDB     downloadDatabase
 	imgStore *duplo.Store
 	loop     chan os.Signal
 
-	googleDriveService *drive.Service
+	googleDriveService atomic.Pointer[drive.Service] // replaced when settings are reloaded, while downloads use it
 
 	startTime        time.Time
 	timeLastUpdated  time.Time
-	cachedDownloadID int
+	cachedDownloadID int64
 )
 
 func init() {
@@ -52,13 +53,18 @@ func init() {
 func main() {
 	var err error
 
+	// Command Line Modes
+	if handled, exitCode := runCommandLine(os.Args[1:]); handled {
+		os.Exit(exitCode)
+	}
+
 	// Config
 	log.Println(color.YellowString("Loading settings from \"%s\"...", configPath))
 	loadConfig()
 	log.Println(color.HiYellowString("Settings loaded, bound to %d channel(s)", getBoundChannelsCount()))
 
 	// Github Update Check
-	if config.GithubUpdateChecking {
+	if getConfig().GithubUpdateChecking {
 		if !isLatestGithubRelease() {
 			log.Println(color.HiCyanString("Update available on %s\n", projectReleaseURL))
 			time.Sleep(5 * time.Second)
@@ -67,99 +73,23 @@ func main() {
 
 	// Database
 	log.Println(color.YellowString("Opening database..."))
-	myDB, err = db.OpenDB(databasePath)
-	if err != nil {
+	if err := openDatabase(); err != nil {
 		log.Println(color.HiRedString("Unable to open database: %s", err))
 		return
 	}
-	if myDB.Use("Downloads") == nil {
-		log.Println(color.YellowString("Creating database, please wait..."))
-		if err := myDB.Create("Downloads"); err != nil {
-			log.Println(color.HiRedString("Error while trying to create database: %s", err))
-			return
-		}
-		log.Println(color.HiYellowString("Created new database..."))
-		log.Println(color.YellowString("Indexing database, please wait..."))
-		if err := myDB.Use("Downloads").Index([]string{"URL"}); err != nil {
-			log.Println(color.HiRedString("Unable to create database index for URL: %s", err))
-			return
-		}
-		if err := myDB.Use("Downloads").Index([]string{"ChannelID"}); err != nil {
-			log.Println(color.HiRedString("Unable to create database index for ChannelID: %s", err))
-			return
-		}
-		if err := myDB.Use("Downloads").Index([]string{"UserID"}); err != nil {
-			log.Println(color.HiRedString("Unable to create database index for UserID: %s", err))
-			return
-		}
-		log.Println(color.HiYellowString("Created database indexes..."))
-	}
 	// Cache download tally
-	cachedDownloadID = dbDownloadCount()
+	cachedDownloadID = int64(dbDownloadCount())
 
 	// Image Store
-	if config.FilterDuplicateImages {
-		imgStore = duplo.New()
-		if _, err := os.Stat(imgStorePath); err == nil {
-			storeFile, err := ioutil.ReadFile(imgStorePath)
-			if err != nil {
-				log.Println(color.HiRedString("Error opening imgStore file:\t%s", err))
-			} else {
-				err = imgStore.GobDecode(storeFile)
-				if err != nil {
-					log.Println(color.HiRedString("Error decoding imgStore:\t%s", err))
-				}
-			}
-		}
+	if getConfig().FilterDuplicateImages {
+		loadImgStore()
 	}
 
 	// Twitter API
-	if config.Credentials.TwitterAccessToken != "" &&
-		config.Credentials.TwitterAccessTokenSecret != "" &&
-		config.Credentials.TwitterConsumerKey != "" &&
-		config.Credentials.TwitterConsumerSecret != "" {
-
-		log.Println(color.MagentaString("Connecting to Twitter API..."))
-
-		twitterClient = anaconda.NewTwitterApiWithCredentials(
-			config.Credentials.TwitterAccessToken,
-			config.Credentials.TwitterAccessTokenSecret,
-			config.Credentials.TwitterConsumerKey,
-			config.Credentials.TwitterConsumerSecret,
-		)
-
-		twitterSelf, err := twitterClient.GetSelf(url.Values{})
-		if err != nil {
-			log.Println(color.HiRedString("Error encountered while connecting to Twitter API, the bot won't use the Twitter API. Error: %s", err.Error()))
-		} else {
-			log.Println(color.HiMagentaString("Connected to Twitter API (@%s)", twitterSelf.ScreenName))
-		}
-	} else {
-		log.Println(color.MagentaString("Twitter API credentials missing, the bot won't use the Twitter API."))
-	}
+	connectTwitter()
 
 	// Google Drive Client
-	if config.Credentials.GoogleDriveCredentialsJSON != "" {
-		log.Println(color.MagentaString("Connecting to Google Drive Client..."))
-		ctx := context.Background()
-		authJson, err := ioutil.ReadFile(config.Credentials.GoogleDriveCredentialsJSON)
-		if err != nil {
-			log.Println(color.HiRedString("Error opening Google Credentials JSON:\t%s", err))
-		} else {
-			googleConfig, err := google.JWTConfigFromJSON(authJson, drive.DriveReadonlyScope)
-			if err != nil {
-				log.Println(color.HiRedString("Error parsing Google Credentials JSON:\t%s", err))
-			} else {
-				client := googleConfig.Client(ctx)
-				googleDriveService, err = drive.New(client)
-				if err != nil {
-					log.Println(color.HiRedString("Error setting up Google Drive Client:\t%s", err))
-				} else {
-					log.Println(color.HiMagentaString("Connected to Google Drive Client"))
-				}
-			}
-		}
-	}
+	connectGoogleDrive()
 
 	// Regex
 	err = compileRegex()
@@ -168,35 +98,29 @@ func main() {
 		return
 	}
 
+	// Extractors
+	registerExtractors()
+
 	// Bot Login
-	if config.Credentials.Token != "" && config.Credentials.Token != placeholderToken {
-		log.Println(color.GreenString("Connecting to Discord via Token..."))
-		bot, err = discordgo.New("Bot " + config.Credentials.Token)
-	} else if (config.Credentials.Email != "" && config.Credentials.Email != placeholderEmail) &&
-		(config.Credentials.Password != "" && config.Credentials.Password != placeholderPassword) {
-		log.Println(color.GreenString("Connecting to Discord via Login..."))
-		bot, err = discordgo.New(config.Credentials.Email, config.Credentials.Password)
-	} else {
-		log.Println(color.HiRedString("No valid credentials for Discord..."))
-		properExit()
+	token, err := getDiscordToken()
+	if err == nil {
+		bot, err = discordgo.New(token)
 	}
 	if err != nil {
-		// Newer discordgo throws this error for some reason with Email/Password login
-		if err.Error() != "Unable to fetch discord authentication token. <nil>" {
-			log.Println(color.HiRedString("Error logging into Discord: %s", err))
-			properExit()
-		}
+		log.Println(color.HiRedString("Error logging into Discord: %s", err))
+		properExit()
+	}
+	bot.Identify.Intents = getDiscordIntents()
+	if !getConfig().MessageContentIntent {
+		log.Println(color.YellowString("messageContentIntent is off, only messages that mention the bot & direct messages can be read"))
 	}
 
 	// Open Bot, Fetch User
 	err = bot.Open()
 	if err == nil {
-		user, err = bot.User("@me")
-		if err != nil {
-			log.Println(color.HiRedString("Error obtaining bot user details: %s", err))
-		} else {
-			log.Println(color.HiGreenString("Discord logged into %s", getUserIdentifier(*user)))
-			if user.Bot {
+		err = fetchBotUser()
+		if err == nil {
+			if getBotUser().Bot {
 				log.Println(logPrefixHelper, color.MagentaString("This is a Bot User..."))
 				log.Println(logPrefixHelper, color.MagentaString("- Status presence details are limited."))
 				log.Println(logPrefixHelper, color.MagentaString("- Server access is restricted to servers you have permission to add the bot to."))
@@ -208,7 +132,7 @@ func main() {
 			}
 		}
 	} else {
-		log.Println(color.HiRedString("Discord login failed:\t%s", err))
+		log.Println(color.HiRedString("Discord login failed:\t%s", describeDiscordOpenError(err)))
 	}
 
 	// Command Router
@@ -259,6 +183,7 @@ func main() {
 	}).Cat("Utility").Alias("test").Desc("Pings the bot")
 
 	router.Default = router.On("help", func(ctx *exrouter.Context) {
+		config := getConfig()
 		logPrefixHere := color.CyanString("[dgrouter:help]")
 		if isCommandableChannel(ctx.Msg) {
 			text := ""
@@ -285,19 +210,24 @@ func main() {
 
 	// Commands: Info
 	router.On("status", func(ctx *exrouter.Context) {
+		config := getConfig()
 		logPrefixHere := color.CyanString("[dgrouter:status]")
 		if isCommandableChannel(ctx.Msg) {
+			queued, active := getDownloadQueueLength()
 			message := fmt.Sprintf("• **Uptime —** %s\n"+
 				"• **Started at —** %s\n"+
 				"• **Joined Servers —** %d\n"+
 				"• **Bound Channels —** %d\n"+
 				"• **Admin Channels —** %d\n"+
+				"• **Download Queue —** %d queued, %d active\n"+
 				"• **Heartbeat Latency —** %dms",
 				durafmt.Parse(time.Since(startTime)).String(),
 				startTime.Format("03:04:05pm on Monday, January 2, 2006 (MST)"),
 				len(bot.State.Guilds),
 				getBoundChannelsCount(),
 				len(config.AdminChannels),
+				queued,
+				active,
 				bot.HeartbeatLatency().Milliseconds(),
 			)
 			if isChannelRegistered(ctx.Msg.ChannelID) {
@@ -318,10 +248,13 @@ func main() {
 		if isChannelRegistered(ctx.Msg.ChannelID) {
 			channelConfig := getChannelConfig(ctx.Msg.ChannelID)
 			if *channelConfig.AllowCommands {
+				duplicateCount, duplicateSize := dbDuplicateStats()
 				content := fmt.Sprintf("• **Total Downloads —** %s\n"+
-					"• **Downloads in this Channel —** %s",
+					"• **Downloads in this Channel —** %s\n"+
+					"• **Duplicates not Stored Again —** %s _(%s saved)_",
 					formatNumber(int64(dbDownloadCount())),
 					formatNumber(int64(dbDownloadCountByChannel(ctx.Msg.ChannelID))),
+					formatNumber(int64(duplicateCount)), formatBytes(duplicateSize),
 				)
 				//TODO: Count in channel by users
 				_, err := replyEmbed(ctx.Msg, "Command — Stats", content)
@@ -338,13 +271,20 @@ func main() {
 	router.On("history", func(ctx *exrouter.Context) {
 		logPrefixHere := color.CyanString("[dgrouter:history]")
 		channel := ctx.Msg.ChannelID
-		args := ctx.Args.After(1)
+		action, channels, options, err := parseHistoryArgs(ctx.Args[1:])
+		if err != nil && (isChannelRegistered(channel) || isAdminChannelRegistered(channel)) {
+			_, err := replyEmbed(ctx.Msg, "Command — History", fmt.Sprintf("%s\n\n_Ex:_ ``<prefix>history since:2021-01-01 before:2021-06-30``", err))
+			if err != nil {
+				log.Println(logPrefixHere, color.HiRedString("Failed to send command embed message (requested by %s)...\t%s", getUserIdentifier(*ctx.Msg.Author), err))
+			}
+			return
+		}
 		if isChannelRegistered(channel) { // Local
 			channelConfig := getChannelConfig(channel)
 			if *channelConfig.AllowCommands {
 				if isLocalAdmin(ctx.Msg) {
 					// Cancel Local
-					if historyCommandActive[channel] == "downloading" && strings.ToLower(strings.TrimSpace(args)) == "cancel" {
+					if historyCommandActive[channel] == "downloading" && action == "cancel" {
 						historyCommandActive[channel] = "cancel"
 						_, err := replyEmbed(ctx.Msg, "Command — History", cmderrHistoryCancelled)
 						if err != nil {
@@ -355,7 +295,11 @@ func main() {
 						_, historyCommandIsSet := historyCommandActive[channel]
 						if !historyCommandIsSet || historyCommandActive[channel] == "" {
 							historyCommandActive[channel] = ""
-							handleHistory(ctx.Msg, channel, channel)
+							if action == "restart" {
+								deleteHistoryCheckpoints(channel)
+								log.Println(logPrefixHere, color.CyanString("%s restarted history cataloging for %s", getUserIdentifier(*ctx.Msg.Author), channel))
+							}
+							handleHistory(ctx.Msg, channel, channel, options)
 						} else {
 							log.Println(logPrefixHere, color.CyanString("%s tried using history command but history is already running for %s...", getUserIdentifier(*ctx.Msg.Author), channel))
 						}
@@ -370,13 +314,10 @@ func main() {
 			}
 		} else if isAdminChannelRegistered(channel) { // Designated
 			if isBotAdmin(ctx.Msg) {
-				channels := strings.Split(args, ",")
 				if len(channels) > 0 {
 					// Cancel Designated
-					if strings.ToLower(strings.TrimSpace(ctx.Args.Get(1))) == "cancel" {
-						channels = strings.Split(ctx.Args.After(2), ",")
+					if action == "cancel" {
 						for _, channelValue := range channels {
-							channelValue = strings.TrimSpace(channelValue)
 							if historyCommandActive[channelValue] == "downloading" {
 								historyCommandActive[channelValue] = "cancel"
 								_, err := replyEmbed(ctx.Msg, "Command — History", cmderrHistoryCancelled)
@@ -388,12 +329,15 @@ func main() {
 						}
 					} else { // Start Designated
 						for _, channelValue := range channels {
-							channelValue = strings.TrimSpace(channelValue)
 							if isChannelRegistered(channelValue) {
 								_, historyCommandIsSet := historyCommandActive[channelValue]
 								if !historyCommandIsSet || historyCommandActive[channelValue] == "" {
 									historyCommandActive[channelValue] = ""
-									handleHistory(ctx.Msg, channel, channelValue)
+									if action == "restart" {
+										deleteHistoryCheckpoints(channelValue)
+										log.Println(logPrefixHere, color.CyanString("%s restarted history cataloging for %s", getUserIdentifier(*ctx.Msg.Author), channelValue))
+									}
+									handleHistory(ctx.Msg, channel, channelValue, options)
 								} else {
 									log.Println(logPrefixHere, color.CyanString("Tried using history command but history is already running for %s...", channelValue))
 								}
@@ -422,6 +366,156 @@ func main() {
 		}
 	}).Alias("catalog", "cache").Cat("Admin").Desc("Catalogs history for this channel")
 
+	router.On("export", func(ctx *exrouter.Context) {
+		logPrefixHere := color.CyanString("[dgrouter:export]")
+		if isCommandableChannel(ctx.Msg) {
+			if isBotAdmin(ctx.Msg) {
+				format, filter, err := parseExportArgs(ctx.Args[1:])
+				if err != nil {
+					replyEmbed(ctx.Msg, "Command — Export", fmt.Sprintf("%s\n\n_Ex:_ ``<prefix>export csv channel:<id> user:<id> since:2021-01-01 until:2021-12-31``", err))
+					return
+				}
+				if err := os.MkdirAll(exportsPath, 0755); err != nil {
+					log.Println(logPrefixHere, color.HiRedString("Failed to create exports folder:\t%s", err))
+					return
+				}
+				exportPath := fmt.Sprintf("%s/downloads-%s.%s", exportsPath, time.Now().Format("2006-01-02_15-04-05"), format)
+				count, err := exportDownloadsToFile(exportPath, format, filter)
+				if err != nil {
+					log.Println(logPrefixHere, color.HiRedString("Export failed:\t%s", err))
+					replyEmbed(ctx.Msg, "Command — Export", fmt.Sprintf("Export failed: %s", err))
+					return
+				}
+				content := fmt.Sprintf("Exported %s download record(s) to ``%s``", formatNumber(int64(count)), exportPath)
+				// Attach it when it fits under Discord's upload limit
+				if info, err := os.Stat(exportPath); err == nil && info.Size() <= 8*1024*1024 {
+					if exportFile, err := os.Open(exportPath); err == nil {
+						_, err = bot.ChannelMessageSendComplex(ctx.Msg.ChannelID, &discordgo.MessageSend{
+							Content: ctx.Msg.Author.Mention(),
+							Embed:   buildEmbed(ctx.Msg.ChannelID, "Command — Export", content),
+							Files:   []*discordgo.File{{Name: filepath.Base(exportPath), Reader: exportFile}},
+						})
+						exportFile.Close()
+						if err == nil {
+							content = ""
+						}
+					}
+				}
+				if content != "" {
+					_, err := replyEmbed(ctx.Msg, "Command — Export", content)
+					if err != nil {
+						log.Println(logPrefixHere, color.HiRedString("Failed to send command embed message (requested by %s)...\t%s", getUserIdentifier(*ctx.Msg.Author), err))
+					}
+				}
+				log.Println(logPrefixHere, color.HiCyanString("%s exported %d download record(s) to \"%s\"", getUserIdentifier(*ctx.Msg.Author), count, exportPath))
+			} else {
+				_, err := replyEmbed(ctx.Msg, "Command — Export", cmderrLackingBotAdminPerms)
+				if err != nil {
+					log.Println(logPrefixHere, color.HiRedString("Failed to send command embed message (requested by %s)...\t%s", getUserIdentifier(*ctx.Msg.Author), err))
+				}
+				log.Println(logPrefixHere, color.HiCyanString("%s tried to export the database but lacked bot admin perms.", getUserIdentifier(*ctx.Msg.Author)))
+			}
+		}
+	}).Cat("Admin").Desc("Exports download records as JSON Lines or CSV")
+
+	router.On("import", func(ctx *exrouter.Context) {
+		logPrefixHere := color.CyanString("[dgrouter:import]")
+		if isCommandableChannel(ctx.Msg) {
+			if isBotAdmin(ctx.Msg) {
+				// Attached export, otherwise a path on the bot's machine
+				importPath := strings.TrimSpace(ctx.Args.After(1))
+				if len(ctx.Msg.Attachments) > 0 {
+					attachment := ctx.Msg.Attachments[0]
+					if err := os.MkdirAll(exportsPath, 0755); err != nil {
+						log.Println(logPrefixHere, color.HiRedString("Failed to create exports folder:\t%s", err))
+						return
+					}
+					importPath = fmt.Sprintf("%s/import-%s-%s", exportsPath, ctx.Msg.ID, filepath.Base(attachment.Filename))
+					if err := saveURLToFile(attachment.URL, importPath); err != nil {
+						log.Println(logPrefixHere, color.HiRedString("Failed to download attached export:\t%s", err))
+						replyEmbed(ctx.Msg, "Command — Import", fmt.Sprintf("Failed to download the attached file: %s", err))
+						return
+					}
+				}
+				if importPath == "" {
+					replyEmbed(ctx.Msg, "Command — Import", "Attach an export file or enter its path...\n\n_Ex:_ ``<prefix>import database/exports/downloads.jsonl``")
+					return
+				}
+				read, imported, err := importDownloadsFromFile(importPath, getExportFormat(importPath))
+				if err != nil {
+					log.Println(logPrefixHere, color.HiRedString("Import failed:\t%s", err))
+					replyEmbed(ctx.Msg, "Command — Import", fmt.Sprintf("Import failed: %s", err))
+					return
+				}
+				atomic.AddInt64(&cachedDownloadID, int64(imported))
+				_, err = replyEmbed(ctx.Msg, "Command — Import", fmt.Sprintf("Imported %s of %s download record(s), %s were already in the database.",
+					formatNumber(int64(imported)), formatNumber(int64(read)), formatNumber(int64(read-imported))))
+				if err != nil {
+					log.Println(logPrefixHere, color.HiRedString("Failed to send command embed message (requested by %s)...\t%s", getUserIdentifier(*ctx.Msg.Author), err))
+				}
+				log.Println(logPrefixHere, color.HiCyanString("%s imported %d of %d download record(s) from \"%s\"", getUserIdentifier(*ctx.Msg.Author), imported, read, importPath))
+			} else {
+				_, err := replyEmbed(ctx.Msg, "Command — Import", cmderrLackingBotAdminPerms)
+				if err != nil {
+					log.Println(logPrefixHere, color.HiRedString("Failed to send command embed message (requested by %s)...\t%s", getUserIdentifier(*ctx.Msg.Author), err))
+				}
+				log.Println(logPrefixHere, color.HiCyanString("%s tried to import download records but lacked bot admin perms.", getUserIdentifier(*ctx.Msg.Author)))
+			}
+		}
+	}).Cat("Admin").Desc("Merges download records from another instance's export")
+
+	router.On("verify", func(ctx *exrouter.Context) {
+		logPrefixHere := color.CyanString("[dgrouter:verify]")
+		if isCommandableChannel(ctx.Msg) {
+			if isBotAdmin(ctx.Msg) {
+				options, err := parseVerifyArgs(ctx.Args[1:])
+				if err != nil {
+					replyEmbed(ctx.Msg, "Command — Verify", fmt.Sprintf("%s\n\n_Ex:_ ``<prefix>verify [purge|requeue] [orphans] [channel:<id>]``", err))
+					return
+				}
+				if !startVerify() {
+					replyEmbed(ctx.Msg, "Command — Verify", "Already verifying downloads, please wait for it to finish...")
+					log.Println(logPrefixHere, color.CyanString("Tried using verify command but verification is already running..."))
+					return
+				}
+				handleVerify(ctx.Msg, options)
+				stopVerify()
+			} else {
+				_, err := replyEmbed(ctx.Msg, "Command — Verify", cmderrLackingBotAdminPerms)
+				if err != nil {
+					log.Println(logPrefixHere, color.HiRedString("Failed to send command embed message (requested by %s)...\t%s", getUserIdentifier(*ctx.Msg.Author), err))
+				}
+				log.Println(logPrefixHere, color.HiCyanString("%s tried to verify downloads but lacked bot admin perms.", getUserIdentifier(*ctx.Msg.Author)))
+			}
+		}
+	}).Cat("Admin").Alias("check").Desc("Checks downloaded files still exist & match their records")
+
+	router.On("index", func(ctx *exrouter.Context) {
+		logPrefixHere := color.CyanString("[dgrouter:index]")
+		if isCommandableChannel(ctx.Msg) {
+			if isBotAdmin(ctx.Msg) {
+				options, err := parseIndexArgs(ctx.Args[1:])
+				if err != nil {
+					replyEmbed(ctx.Msg, "Command — Index", fmt.Sprintf("%s\n\n_Ex:_ ``<prefix>index <folder> [channel:<id>] [links:<path>]``", err))
+					return
+				}
+				if !startIndex() {
+					replyEmbed(ctx.Msg, "Command — Index", "Already indexing a folder, please wait for it to finish...")
+					log.Println(logPrefixHere, color.CyanString("Tried using index command but indexing is already running..."))
+					return
+				}
+				handleIndex(ctx.Msg, options)
+				stopIndex()
+			} else {
+				_, err := replyEmbed(ctx.Msg, "Command — Index", cmderrLackingBotAdminPerms)
+				if err != nil {
+					log.Println(logPrefixHere, color.HiRedString("Failed to send command embed message (requested by %s)...\t%s", getUserIdentifier(*ctx.Msg.Author), err))
+				}
+				log.Println(logPrefixHere, color.HiCyanString("%s tried to index a folder but lacked bot admin perms.", getUserIdentifier(*ctx.Msg.Author)))
+			}
+		}
+	}).Cat("Admin").Alias("adopt").Desc("Records files already in a folder as downloaded")
+
 	router.On("exit", func(ctx *exrouter.Context) {
 		logPrefixHere := color.CyanString("[dgrouter:exit]")
 		if isCommandableChannel(ctx.Msg) {
@@ -440,7 +534,33 @@ func main() {
 				log.Println(logPrefixHere, color.HiCyanString("%s tried to exit but lacked bot admin perms.", getUserIdentifier(*ctx.Msg.Author)))
 			}
 		}
-	}).Alias("reload", "kill").Cat("Admin").Desc("Kills the bot")
+	}).Alias("kill").Cat("Admin").Desc("Kills the bot")
+
+	router.On("reload", func(ctx *exrouter.Context) {
+		logPrefixHere := color.CyanString("[dgrouter:reload]")
+		if isCommandableChannel(ctx.Msg) {
+			if isBotAdmin(ctx.Msg) {
+				log.Println(logPrefixHere, color.HiCyanString("%s requested settings reload", getUserIdentifier(*ctx.Msg.Author)))
+				notes, err := reloadConfig()
+				content := "Settings reloaded from ``" + configPath + "``."
+				if err != nil {
+					content = fmt.Sprintf("Settings were not reloaded, still using the previous settings.\n```%s```", err)
+				} else if len(notes) > 0 {
+					content += "\n\n• " + strings.Join(notes, "\n• ")
+				}
+				_, err = replyEmbed(ctx.Msg, "Command — Reload", content)
+				if err != nil {
+					log.Println(logPrefixHere, color.HiRedString("Failed to send command embed message (requested by %s)...\t%s", getUserIdentifier(*ctx.Msg.Author), err))
+				}
+			} else {
+				_, err := replyEmbed(ctx.Msg, "Command — Reload", cmderrLackingBotAdminPerms)
+				if err != nil {
+					log.Println(logPrefixHere, color.HiRedString("Failed to send command embed message (requested by %s)...\t%s", getUserIdentifier(*ctx.Msg.Author), err))
+				}
+				log.Println(logPrefixHere, color.HiCyanString("%s tried to reload settings but lacked bot admin perms.", getUserIdentifier(*ctx.Msg.Author)))
+			}
+		}
+	}).Cat("Admin").Alias("refresh").Desc("Reloads settings without restarting")
 
 	//TODO: add_channel command
 	//TODO: edit_channel command
@@ -450,20 +570,39 @@ func main() {
 
 	// Handler for Command Router
 	bot.AddHandler(func(_ *discordgo.Session, m *discordgo.MessageCreate) {
-		//NOTE: This setup makes it case-insensitive but message content will be lowercase, currently case sensitivity is not necessary.
-		router.FindAndExecute(bot, strings.ToLower(config.CommandPrefix), bot.State.User.ID, messageToLower(m.Message))
+		config := getConfig()
+		prefix := strings.ToLower(config.CommandPrefix)
+		router.FindAndExecute(bot, prefix, bot.State.User.ID, commandToLower(m.Message, prefix))
 	})
 
 	// Event Handlers
 	bot.AddHandler(messageCreate)
 	bot.AddHandler(messageUpdate)
+	// A new session after a reconnect doesn't replay what was missed, resumed ones do
+	bot.AddHandler(func(_ *discordgo.Session, _ *discordgo.Ready) {
+		go catchUpMissedMessages()
+	})
 
 	// Start Presence
 	timeLastUpdated = time.Now()
 	updateDiscordPresence()
 
+	// Download Queue
+	loadDownloadQueue()
+	startDownloadWorkers()
+
+	// Resume interrupted downloads
+	go sweepPartialDownloads()
+
+	// Messages posted while offline
+	go catchUpMissedMessages()
+	go watchLastSeenMessages()
+
+	// Settings changes
+	go watchConfig()
+
 	// Tickers
-	if config.DebugOutput {
+	if getConfig().DebugOutput {
 		log.Println(logPrefixDebug, color.YellowString("Starting background loops..."))
 	}
 	ticker5m := time.NewTicker(5 * time.Minute)
@@ -478,7 +617,7 @@ func main() {
 	}()
 
 	// Output Startup Duration
-	if config.DebugOutput {
+	if getConfig().DebugOutput {
 		log.Println(logPrefixDebug, color.YellowString("Startup finished, took %s...", uptime()))
 	}
 
@@ -490,6 +629,10 @@ func main() {
 	signal.Notify(loop, syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT, os.Interrupt, os.Kill)
 	<-loop
 
+	log.Println(color.YellowString("Stopping download queue..."))
+	stopDownloadWorkers(10 * time.Second)
+	saveLastSeenMessages()
+
 	log.Println(color.GreenString("Logging out of discord..."))
 	bot.Close()
 
@@ -498,3 +641,59 @@ func main() {
 
 	log.Println(color.HiRedString("Exiting..."))
 }
+
+func connectTwitter() {
+	config := getConfig()
+	twitterClient.Store(nil)
+	if config.Credentials.TwitterAccessToken != "" &&
+		config.Credentials.TwitterAccessTokenSecret != "" &&
+		config.Credentials.TwitterConsumerKey != "" &&
+		config.Credentials.TwitterConsumerSecret != "" {
+
+		log.Println(color.MagentaString("Connecting to Twitter API..."))
+
+		client := anaconda.NewTwitterApiWithCredentials(
+			config.Credentials.TwitterAccessToken,
+			config.Credentials.TwitterAccessTokenSecret,
+			config.Credentials.TwitterConsumerKey,
+			config.Credentials.TwitterConsumerSecret,
+		)
+		twitterClient.Store(client)
+
+		twitterSelf, err := client.GetSelf(url.Values{})
+		if err != nil {
+			log.Println(color.HiRedString("Error encountered while connecting to Twitter API, the bot won't use the Twitter API. Error: %s", err.Error()))
+		} else {
+			log.Println(color.HiMagentaString("Connected to Twitter API (@%s)", twitterSelf.ScreenName))
+		}
+	} else {
+		log.Println(color.MagentaString("Twitter API credentials missing, the bot won't use the Twitter API."))
+	}
+}
+
+func connectGoogleDrive() {
+	config := getConfig()
+	googleDriveService.Store(nil)
+	if config.Credentials.GoogleDriveCredentialsJSON != "" {
+		log.Println(color.MagentaString("Connecting to Google Drive Client..."))
+		ctx := context.Background()
+		authJson, err := ioutil.ReadFile(config.Credentials.GoogleDriveCredentialsJSON)
+		if err != nil {
+			log.Println(color.HiRedString("Error opening Google Credentials JSON:\t%s", err))
+		} else {
+			googleConfig, err := google.JWTConfigFromJSON(authJson, drive.DriveReadonlyScope)
+			if err != nil {
+				log.Println(color.HiRedString("Error parsing Google Credentials JSON:\t%s", err))
+			} else {
+				client := googleConfig.Client(ctx)
+				service, err := drive.New(client)
+				if err != nil {
+					log.Println(color.HiRedString("Error setting up Google Drive Client:\t%s", err))
+				} else {
+					googleDriveService.Store(service)
+					log.Println(color.HiMagentaString("Connected to Google Drive Client"))
+				}
+			}
+		}
+	}
+}
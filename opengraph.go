@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+const (
+	openGraphMaxPageSize   = 2 * 1024 * 1024
+	openGraphMaxOEmbedSize = 256 * 1024
+)
+
+// Last resort for pages no other extractor knows, reads the media a page advertises for link previews
+type openGraphExtractor struct{}
+
+func (e *openGraphExtractor) Name() string {
+	return "opengraph"
+}
+
+func (e *openGraphExtractor) Match(link string) bool {
+	u, err := url.Parse(link)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return false
+	}
+	// Links with a file extension are usually the file itself
+	if extension := filepath.Ext(u.Path); extension != "" {
+		if contentType := mime.TypeByExtension(extension); contentType != "" && !strings.HasPrefix(contentType, "text/html") {
+			return false
+		}
+	}
+	return true
+}
+
+func (e *openGraphExtractor) Extract(ctx context.Context, link string, channelID string) ([]*fileItem, error) {
+	channelConfig := getChannelConfig(channelID)
+	if isDomainBlacklisted(channelConfig, link) {
+		return nil, nil
+	}
+
+	response, err := openGraphRequest(ctx, link)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	if !strings.Contains(response.Header.Get("Content-Type"), "text/html") {
+		return nil, nil
+	}
+
+	doc, err := goquery.NewDocumentFromReader(io.LimitReader(response.Body, openGraphMaxPageSize))
+	if err != nil {
+		return nil, err
+	}
+	pageURL := response.Request.URL
+
+	var links []string
+	addLink := func(value string) {
+		resolved := resolveOpenGraphLink(pageURL, value)
+		if resolved == "" || isDomainBlacklisted(channelConfig, resolved) || stringInSlice(resolved, links) {
+			return
+		}
+		links = append(links, resolved)
+	}
+
+	// Videos first, pages with a video usually also set its thumbnail as image
+	for _, property := range []string{
+		"og:video:secure_url", "og:video:url", "og:video",
+		"og:image:secure_url", "og:image:url", "og:image",
+		"twitter:image", "twitter:image:src",
+	} {
+		selector := fmt.Sprintf(`meta[property="%s"], meta[name="%s"]`, property, property)
+		doc.Find(selector).Each(func(i int, s *goquery.Selection) {
+			if content, exists := s.Attr("content"); exists {
+				addLink(content)
+			}
+		})
+	}
+
+	doc.Find(`link[type="application/json+oembed"]`).Each(func(i int, s *goquery.Selection) {
+		href, exists := s.Attr("href")
+		if !exists {
+			return
+		}
+		oEmbedURL := resolveOpenGraphLink(pageURL, href)
+		if oEmbedURL == "" || isDomainBlacklisted(channelConfig, oEmbedURL) {
+			return
+		}
+		if mediaURL, err := getOEmbedMediaURL(ctx, oEmbedURL); err == nil {
+			addLink(mediaURL)
+		}
+	})
+
+	var items []*fileItem
+	for _, mediaURL := range links {
+		items = append(items, &fileItem{Link: mediaURL})
+	}
+	return items, nil
+}
+
+type oEmbedResponse struct {
+	Type         string `json:"type"`
+	URL          string `json:"url"`
+	ThumbnailURL string `json:"thumbnail_url"`
+}
+
+// Photo embeds link the full image, other types only have a thumbnail worth saving
+func getOEmbedMediaURL(ctx context.Context, oEmbedURL string) (string, error) {
+	response, err := openGraphRequest(ctx, oEmbedURL)
+	if err != nil {
+		return "", err
+	}
+	defer response.Body.Close()
+
+	var embed oEmbedResponse
+	err = json.NewDecoder(io.LimitReader(response.Body, openGraphMaxOEmbedSize)).Decode(&embed)
+	if err != nil {
+		return "", err
+	}
+	if embed.Type == "photo" && embed.URL != "" {
+		return embed.URL, nil
+	}
+	return embed.ThumbnailURL, nil
+}
+
+func openGraphRequest(ctx context.Context, link string) (*http.Response, error) {
+	request, err := http.NewRequestWithContext(ctx, "GET", link, nil)
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("User-Agent", fmt.Sprintf("%s/%s", projectName, projectVersion))
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		response.Body.Close()
+		return nil, fmt.Errorf("page returned status %s", response.Status)
+	}
+	return response, nil
+}
+
+func resolveOpenGraphLink(pageURL *url.URL, value string) string {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return ""
+	}
+	u, err := url.Parse(value)
+	if err != nil {
+		return ""
+	}
+	u = pageURL.ResolveReference(u)
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return ""
+	}
+	return u.String()
+}
@@ -10,6 +10,7 @@ import (
 	"regexp"
 	"strconv"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/ChimeraCoder/anaconda"
@@ -20,7 +21,7 @@ import (
 )
 
 var (
-	twitterClient *anaconda.TwitterApi
+	twitterClient atomic.Pointer[anaconda.TwitterApi] // replaced when settings are reloaded, while downloads use it
 )
 
 func getTwitterUrls(inputURL string) (map[string]string, error) {
@@ -32,7 +33,8 @@ func getTwitterUrls(inputURL string) (map[string]string, error) {
 }
 
 func getTwitterStatusUrls(inputURL string, channelID string) (map[string]string, error) {
-	if twitterClient == nil {
+	client := twitterClient.Load()
+	if client == nil {
 		return nil, errors.New("Invalid Twitter API Keys Set")
 	}
 
@@ -42,7 +44,7 @@ func getTwitterStatusUrls(inputURL string, channelID string) (map[string]string,
 		return nil, err
 	}
 
-	tweet, err := twitterClient.GetTweet(statusId, nil)
+	tweet, err := client.GetTweet(statusId, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -61,15 +63,15 @@ func getTwitterStatusUrls(inputURL string, channelID string) (map[string]string,
 			}
 		} else {
 			foundUrls := getDownloadLinks(tweetMedia.Media_url_https, channelID)
-			for foundUrlKey, foundUrlValue := range foundUrls {
-				links[foundUrlKey] = foundUrlValue
+			for _, foundUrl := range foundUrls {
+				links[foundUrl.Link] = foundUrl.Filename
 			}
 		}
 	}
 	for _, tweetUrl := range tweet.Entities.Urls {
 		foundUrls := getDownloadLinks(tweetUrl.Expanded_url, channelID)
-		for foundUrlKey, foundUrlValue := range foundUrls {
-			links[foundUrlKey] = foundUrlValue
+		for _, foundUrl := range foundUrls {
+			links[foundUrl.Link] = foundUrl.Filename
 		}
 	}
 
@@ -392,6 +394,7 @@ type flickrPhotoObject struct {
 }
 
 func getFlickrUrlFromPhotoId(photoId string) string {
+	config := getConfig()
 	reqUrl := fmt.Sprintf("https://www.flickr.com/services/rest/?format=json&nojsoncallback=1&method=%s&api_key=%s&photo_id=%s",
 		"flickr.photos.getSizes", config.Credentials.FlickrApiKey, photoId)
 	flickrPhoto := new(flickrPhotoObject)
@@ -410,6 +413,7 @@ func getFlickrUrlFromPhotoId(photoId string) string {
 }
 
 func getFlickrPhotoUrls(url string) (map[string]string, error) {
+	config := getConfig()
 	if config.Credentials.FlickrApiKey == "" {
 		return nil, errors.New("Invalid Flickr API Key Set")
 	}
@@ -449,6 +453,7 @@ type flickrAlbumObject struct {
 }
 
 func getFlickrAlbumUrls(url string) (map[string]string, error) {
+	config := getConfig()
 	if config.Credentials.FlickrApiKey == "" {
 		return nil, errors.New("Invalid Flickr API Key Set")
 	}
@@ -496,7 +501,8 @@ func getGoogleDriveFolderUrls(url string) (map[string]string, error) {
 	if len(matches) < 4 || matches[3] == "" {
 		return nil, errors.New("unable to find google drive folder ID in link")
 	}
-	if googleDriveService.BasePath == "" {
+	service := googleDriveService.Load()
+	if service == nil || service.BasePath == "" {
 		return nil, errors.New("please set up google credentials")
 	}
 	googleDriveFolderID := matches[3]
@@ -505,7 +511,7 @@ func getGoogleDriveFolderUrls(url string) (map[string]string, error) {
 
 	driveQuery := fmt.Sprintf("\"%s\" in parents", googleDriveFolderID)
 	driveFields := "nextPageToken, files(id)"
-	result, err := googleDriveService.Files.List().Q(driveQuery).Fields(googleapi.Field(driveFields)).PageSize(1000).Do()
+	result, err := service.Files.List().Q(driveQuery).Fields(googleapi.Field(driveFields)).PageSize(1000).Do()
 	if err != nil {
 		log.Println("driveQuery:", driveQuery)
 		log.Println("driveFields:", driveFields)
@@ -521,7 +527,7 @@ func getGoogleDriveFolderUrls(url string) (map[string]string, error) {
 		if result.NextPageToken == "" {
 			break
 		}
-		result, err = googleDriveService.Files.List().Q(driveQuery).Fields(googleapi.Field(driveFields)).PageSize(1000).PageToken(result.NextPageToken).Do()
+		result, err = service.Files.List().Q(driveQuery).Fields(googleapi.Field(driveFields)).PageSize(1000).PageToken(result.NextPageToken).Do()
 		if err != nil {
 			return nil, err
 		}
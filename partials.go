@@ -0,0 +1,252 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/fatih/color"
+)
+
+const (
+	partialFileSuffix = ".part"
+	partialMetaSuffix = ".part.json"
+)
+
+// Everything needed to resume an interrupted download, stored next to the .part file
+type partialDownload struct {
+	URL          string
+	Filename     string
+	Path         string
+	Destination  string
+	ContentType  string
+	MimeType     string
+	SourceURL    string
+	Extractor    string
+	ETag         string
+	LastModified string
+	Size         int64
+	MessageID    string
+	ChannelID    string
+	GuildID      string
+	UserID       string
+	FileTime     time.Time
+	AudioLink    string // Reddit videos get their audio added once complete
+	Time         time.Time
+}
+
+var (
+	partialDownloads      = make(map[string]*partialDownload)
+	partialDownloadsMutex sync.Mutex
+)
+
+func partialDownloadKey(inputURL string, channelID string) string {
+	return channelID + "|" + inputURL
+}
+
+// Records a download as resumable before it's streamed, removed again once it completes
+func savePartialDownload(partial *partialDownload) {
+	metaJSON, err := json.MarshalIndent(partial, "", "\t")
+	if err != nil {
+		log.Println(color.HiRedString("[savePartialDownload] Failed to format partial download info:\t%s", err))
+		return
+	}
+	err = ioutil.WriteFile(partial.Destination+partialMetaSuffix, metaJSON, 0644)
+	if err != nil {
+		log.Println(color.HiRedString("[savePartialDownload] Failed to save partial download info:\t%s", err))
+		return
+	}
+	partialDownloadsMutex.Lock()
+	partialDownloads[partialDownloadKey(partial.URL, partial.ChannelID)] = partial
+	partialDownloadsMutex.Unlock()
+}
+
+func getPartialDownload(inputURL string, channelID string) *partialDownload {
+	partialDownloadsMutex.Lock()
+	partial := partialDownloads[partialDownloadKey(inputURL, channelID)]
+	partialDownloadsMutex.Unlock()
+	if partial == nil {
+		return nil
+	}
+	if _, err := os.Stat(partial.Destination + partialFileSuffix); err != nil {
+		removePartialDownload(partial)
+		return nil
+	}
+	return partial
+}
+
+func removePartialDownload(partial *partialDownload) {
+	partialDownloadsMutex.Lock()
+	delete(partialDownloads, partialDownloadKey(partial.URL, partial.ChannelID))
+	partialDownloadsMutex.Unlock()
+	os.Remove(partial.Destination + partialFileSuffix)
+	os.Remove(partial.Destination + partialMetaSuffix)
+}
+
+func (partial *partialDownload) setRangeHeaders(request *http.Request) {
+	info, err := os.Stat(partial.Destination + partialFileSuffix)
+	if err != nil {
+		return
+	}
+	request.Header.Set("Range", fmt.Sprintf("bytes=%d-", info.Size()))
+	// Weak ETags can't be used for If-Range
+	if partial.ETag != "" && !strings.HasPrefix(partial.ETag, "W/") {
+		request.Header.Set("If-Range", partial.ETag)
+	} else if partial.LastModified != "" {
+		request.Header.Set("If-Range", partial.LastModified)
+	}
+}
+
+// Checks the server actually sent the remainder of the same file
+func (partial *partialDownload) isResumableResponse(response *http.Response) bool {
+	if response.StatusCode != http.StatusPartialContent {
+		return false
+	}
+	info, err := os.Stat(partial.Destination + partialFileSuffix)
+	if err != nil {
+		return false
+	}
+	var start, end int64
+	var total string
+	_, err = fmt.Sscanf(response.Header.Get("Content-Range"), "bytes %d-%d/%s", &start, &end, &total)
+	if err != nil || start != info.Size() {
+		return false
+	}
+	if partial.Size > 0 && total != "*" && total != strconv.FormatInt(partial.Size, 10) {
+		return false
+	}
+	return true
+}
+
+func resumePartialDownload(partial *partialDownload, file *fileItem, response *http.Response, message *discordgo.Message, historyCmd bool,
+	thisDownloadID int, startTime time.Time) downloadStatusStruct {
+	logPrefixErrorHere := color.HiRedString("[resumePartialDownload]")
+	partPath := partial.Destination + partialFileSuffix
+
+	log.Println(color.YellowString("Resuming partial download of %s (%s)", partial.URL, response.Header.Get("Content-Range")))
+
+	partFile, err := os.OpenFile(partPath, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		log.Println(logPrefixErrorHere, color.HiRedString("Error while opening partial file for \"%s\": %s", partial.URL, err))
+		removePartialDownload(partial)
+		return mDownloadStatus(downloadFailedWritingFile, err)
+	}
+	_, err = io.Copy(partFile, response.Body)
+	partFile.Close()
+	if err != nil {
+		// Leave the partial file in place for the next attempt
+		log.Println(logPrefixErrorHere, color.HiRedString("Error while streaming response to disk \"%s\": %s", partial.URL, err))
+		return mDownloadStatus(downloadFailedReadResponse, err)
+	}
+
+	// Same checks a download gets once it's written
+	extension := strings.ToLower(filepath.Ext(partial.Filename))
+	contentHash, size, imageHash, status := checkWrittenFile(partPath, partial.URL, partial.AudioLink, extension, partial.ContentType, "", 0, true)
+	if status != nil {
+		removePartialDownload(partial)
+		return *status
+	}
+	completePath, status := checkDestinationExists(partial.Destination, getChannelConfig(message.ChannelID))
+	if status != nil {
+		removePartialDownload(partial)
+		return *status
+	}
+	err = os.Rename(partPath, completePath)
+	if err != nil {
+		log.Println(logPrefixErrorHere, color.HiRedString("Error while writing file to disk \"%s\": %s", partial.URL, err))
+		removePartialDownload(partial)
+		return mDownloadStatus(downloadFailedWritingFile, err)
+	}
+	removePartialDownload(partial)
+
+	finalStatus := finalizeDownload(file, &download{
+		URL:         partial.URL,
+		Destination: completePath,
+		Filename:    partial.Filename,
+		Size:        size,
+		ContentType: partial.MimeType,
+		Hash:        contentHash,
+	}, partial.ContentType, message, partial.FileTime, historyCmd, thisDownloadID, startTime)
+	addDuplicateImage(finalStatus, thisDownloadID, imageHash)
+	return finalStatus
+}
+
+// Resumes or cleans up partial downloads left behind in channel destinations by a previous run
+func sweepPartialDownloads() {
+	config := getConfig()
+	logPrefixHere := color.CyanString("[sweepPartialDownloads]")
+	maxAge := time.Duration(config.PartialDownloadMaxAge) * time.Hour
+
+	var destinations []string
+	for _, channel := range config.Channels {
+		if channel.Destination != "" && !stringInSlice(channel.Destination, destinations) {
+			destinations = append(destinations, channel.Destination)
+		}
+	}
+
+	var resumable []*partialDownload
+	for _, destination := range destinations {
+		filepath.Walk(destination, func(path string, info os.FileInfo, err error) error {
+			if err != nil || info.IsDir() {
+				return nil
+			}
+			if strings.HasSuffix(path, partialMetaSuffix) {
+				partial := new(partialDownload)
+				metaJSON, err := ioutil.ReadFile(path)
+				if err == nil {
+					err = json.Unmarshal(metaJSON, partial)
+				}
+				_, partErr := os.Stat(strings.TrimSuffix(path, partialMetaSuffix) + partialFileSuffix)
+				if err != nil || partErr != nil || time.Since(partial.Time) > maxAge || !isChannelRegistered(partial.ChannelID) {
+					log.Println(logPrefixHere, color.YellowString("Removing stale partial download \"%s\"", path))
+					os.Remove(path)
+					os.Remove(strings.TrimSuffix(path, partialMetaSuffix) + partialFileSuffix)
+				} else {
+					resumable = append(resumable, partial)
+				}
+			} else if strings.HasSuffix(path, partialFileSuffix) {
+				if _, err := os.Stat(strings.TrimSuffix(path, partialFileSuffix) + partialMetaSuffix); os.IsNotExist(err) {
+					log.Println(logPrefixHere, color.YellowString("Removing orphaned partial download \"%s\"", path))
+					os.Remove(path)
+				}
+			}
+			return nil
+		})
+	}
+
+	for _, partial := range resumable {
+		partialDownloadsMutex.Lock()
+		partialDownloads[partialDownloadKey(partial.URL, partial.ChannelID)] = partial
+		partialDownloadsMutex.Unlock()
+
+		log.Println(logPrefixHere, color.CyanString("Resuming partial download of %s", partial.URL))
+		queueDownload(&downloadJob{
+			File: &fileItem{
+				Link:       partial.URL,
+				SourceLink: partial.SourceURL,
+				Filename:   partial.Filename,
+				Time:       partial.FileTime,
+				Extractor:  partial.Extractor,
+				AudioLink:  partial.AudioLink,
+			},
+			Path: partial.Path,
+			Message: &discordgo.Message{
+				ID:        partial.MessageID,
+				ChannelID: partial.ChannelID,
+				GuildID:   partial.GuildID,
+				Author:    &discordgo.User{ID: partial.UserID},
+			},
+			HistoryCmd: true,
+		})
+	}
+}
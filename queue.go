@@ -0,0 +1,233 @@
+package main
+
+import (
+	"io/ioutil"
+	"log"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/fatih/color"
+	"github.com/rivo/duplo"
+)
+
+// A pending download, persisted in the database until it has been processed
+type downloadJob struct {
+	File       *fileItem
+	Path       string
+	Message    *discordgo.Message
+	HistoryCmd bool
+	Queued     time.Time
+
+	id     int // database document ID
+	domain string
+	done   chan downloadStatusStruct
+}
+
+var (
+	downloadQueue        []*downloadJob
+	downloadQueueMutex   sync.Mutex
+	downloadQueueCond    = sync.NewCond(&downloadQueueMutex)
+	downloadQueueDomains = make(map[string]int) // active jobs per domain
+	downloadQueueActive  int
+	downloadQueueStopped bool
+
+	imgStoreMutex sync.Mutex
+)
+
+func getDownloadDomain(link string) string {
+	u, err := url.Parse(link)
+	if err != nil {
+		return ""
+	}
+	return strings.ToLower(u.Hostname())
+}
+
+// Adds a download to the queue, the returned channel receives the result once processed
+func queueDownload(job *downloadJob) <-chan downloadStatusStruct {
+	job.done = make(chan downloadStatusStruct, 1)
+	job.domain = getDownloadDomain(job.File.Link)
+	if job.Queued.IsZero() {
+		job.Queued = time.Now()
+	}
+
+	id, err := dbInsertQueuedDownload(job)
+	if err != nil {
+		log.Println(color.HiRedString("[queueDownload] Failed to store queued download for %s, it will not survive a restart:\t%s", job.File.Link, err))
+	} else {
+		job.id = id
+	}
+
+	downloadQueueMutex.Lock()
+	if downloadQueueStopped {
+		downloadQueueMutex.Unlock()
+		job.done <- mDownloadStatus(downloadSkippedQueueStopped)
+		return job.done
+	}
+	downloadQueue = append(downloadQueue, job)
+	downloadQueueMutex.Unlock()
+	downloadQueueCond.Signal()
+
+	return job.done
+}
+
+// Restores downloads that were still queued when the bot last stopped
+func loadDownloadQueue() {
+	jobs := dbFindQueuedDownloads()
+	if len(jobs) == 0 {
+		return
+	}
+	sort.Slice(jobs, func(i, j int) bool {
+		return jobs[i].Queued.Before(jobs[j].Queued)
+	})
+	for _, job := range jobs {
+		job.done = make(chan downloadStatusStruct, 1)
+		job.domain = getDownloadDomain(job.File.Link)
+	}
+
+	downloadQueueMutex.Lock()
+	downloadQueue = append(jobs, downloadQueue...)
+	downloadQueueMutex.Unlock()
+	downloadQueueCond.Broadcast()
+
+	log.Println(color.CyanString("Restored %d queued download(s) from previous run", len(jobs)))
+}
+
+func startDownloadWorkers() {
+	config := getConfig()
+	workers := config.DownloadWorkers
+	if workers < 1 {
+		workers = 1
+	}
+	for i := 0; i < workers; i++ {
+		go downloadWorker()
+	}
+	if config.DebugOutput {
+		log.Println(logPrefixDebug, color.YellowString("Started %d download worker(s)...", workers))
+	}
+}
+
+// Stops workers from taking new jobs and waits a short while for active ones, anything left stays queued in the database.
+// Jobs that won't run are answered so nothing waiting on them blocks.
+func stopDownloadWorkers(timeout time.Duration) {
+	downloadQueueMutex.Lock()
+	downloadQueueStopped = true
+	waiting := downloadQueue
+	downloadQueue = nil
+	downloadQueueMutex.Unlock()
+	downloadQueueCond.Broadcast()
+	for _, job := range waiting {
+		job.done <- mDownloadStatus(downloadSkippedQueueStopped)
+	}
+
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		downloadQueueMutex.Lock()
+		active := downloadQueueActive
+		downloadQueueMutex.Unlock()
+		if active == 0 {
+			return
+		}
+		time.Sleep(250 * time.Millisecond)
+	}
+}
+
+func getDownloadQueueLength() (int, int) {
+	downloadQueueMutex.Lock()
+	defer downloadQueueMutex.Unlock()
+	return len(downloadQueue), downloadQueueActive
+}
+
+// Takes the oldest job whose domain isn't at its concurrency limit, blocks until one is available
+func nextDownloadJob() *downloadJob {
+	downloadQueueMutex.Lock()
+	defer downloadQueueMutex.Unlock()
+	for {
+		if downloadQueueStopped {
+			return nil
+		}
+		config := getConfig()
+		for i, job := range downloadQueue {
+			if config.DownloadWorkersPerDomain <= 0 || downloadQueueDomains[job.domain] < config.DownloadWorkersPerDomain {
+				downloadQueue = append(downloadQueue[:i], downloadQueue[i+1:]...)
+				downloadQueueDomains[job.domain]++
+				downloadQueueActive++
+				return job
+			}
+		}
+		downloadQueueCond.Wait()
+	}
+}
+
+func downloadWorker() {
+	for {
+		job := nextDownloadJob()
+		if job == nil {
+			return
+		}
+
+		status := startDownload(job.File, job.Path, job.Message, job.HistoryCmd)
+		if (status.Status == downloadSuccess || status.Status == downloadFailedExternalPartial) && getConfig().FilterDuplicateImages {
+			saveImgStore()
+		}
+
+		if job.id != 0 {
+			if err := dbDeleteQueuedDownload(job.id); err != nil {
+				log.Println(color.HiRedString("[downloadWorker] Failed to remove finished download from queue:\t%s", err))
+			}
+		}
+
+		downloadQueueMutex.Lock()
+		downloadQueueDomains[job.domain]--
+		if downloadQueueDomains[job.domain] <= 0 {
+			delete(downloadQueueDomains, job.domain)
+		}
+		downloadQueueActive--
+		downloadQueueMutex.Unlock()
+		downloadQueueCond.Broadcast()
+
+		job.done <- status
+	}
+}
+
+func loadImgStore() {
+	imgStore = duplo.New()
+	if _, err := os.Stat(imgStorePath); err == nil {
+		storeFile, err := ioutil.ReadFile(imgStorePath)
+		if err != nil {
+			log.Println(color.HiRedString("Error opening imgStore file:\t%s", err))
+		} else {
+			err = imgStore.GobDecode(storeFile)
+			if err != nil {
+				log.Println(color.HiRedString("Error decoding imgStore:\t%s", err))
+			}
+		}
+	}
+}
+
+func saveImgStore() {
+	imgStoreMutex.Lock()
+	defer imgStoreMutex.Unlock()
+	encodedStore, err := imgStore.GobEncode()
+	if err != nil {
+		log.Println(color.HiRedString("Failed to encode imgStore:\t%s", err))
+		return
+	}
+	f, err := os.OpenFile(imgStorePath, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0755)
+	if err != nil {
+		log.Println(color.HiRedString("Failed to open imgStore file:\t%s", err))
+		return
+	}
+	_, err = f.Write(encodedStore)
+	if err != nil {
+		log.Println(color.HiRedString("Failed to update imgStore file:\t%s", err))
+	}
+	err = f.Close()
+	if err != nil {
+		log.Println(color.HiRedString("Failed to close imgStore file:\t%s", err))
+	}
+}
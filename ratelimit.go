@@ -0,0 +1,164 @@
+package main
+
+import (
+	"math"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Token bucket limiting requests to a single domain
+type domainLimiter struct {
+	mutex        sync.Mutex
+	rate         float64 // tokens per second
+	burst        float64
+	tokens       float64
+	last         time.Time
+	blockedUntil time.Time
+}
+
+var (
+	domainLimiters      = make(map[string]*domainLimiter)
+	domainLimitersMutex sync.Mutex
+)
+
+// Finds settings for a domain, also matching subdomains ("cdn.example.com" uses "example.com")
+func getDomainConfig(domain string) *configurationDomain {
+	config := getConfig()
+	domain = strings.ToLower(domain)
+	for i, item := range config.Domains {
+		itemDomain := strings.ToLower(item.Domain)
+		if domain == itemDomain || strings.HasSuffix(domain, "."+itemDomain) {
+			return &config.Domains[i]
+		}
+	}
+	return nil
+}
+
+func getDomainLimiter(domain string) *domainLimiter {
+	config := getConfig()
+	rate := config.DownloadRateLimit
+	burst := config.DownloadRateBurst
+	if domainConfig := getDomainConfig(domain); domainConfig != nil {
+		if domainConfig.RateLimit != nil {
+			rate = *domainConfig.RateLimit
+		}
+		if domainConfig.RateBurst != nil {
+			burst = *domainConfig.RateBurst
+		}
+	}
+	if burst < 1 {
+		burst = 1
+	}
+
+	domainLimitersMutex.Lock()
+	defer domainLimitersMutex.Unlock()
+	limiter, exists := domainLimiters[domain]
+	if !exists {
+		limiter = &domainLimiter{tokens: float64(burst), last: time.Now()}
+		domainLimiters[domain] = limiter
+	}
+	limiter.mutex.Lock()
+	limiter.rate = rate
+	limiter.burst = float64(burst)
+	limiter.mutex.Unlock()
+	return limiter
+}
+
+// Blocks until a request to the link's domain is permitted
+func waitForDomain(link string) {
+	limiter := getDomainLimiter(getDownloadDomain(link))
+	for {
+		limiter.mutex.Lock()
+		now := time.Now()
+		if now.Before(limiter.blockedUntil) {
+			wait := limiter.blockedUntil.Sub(now)
+			limiter.mutex.Unlock()
+			time.Sleep(wait)
+			continue
+		}
+		if limiter.rate <= 0 {
+			limiter.mutex.Unlock()
+			return
+		}
+		limiter.tokens = math.Min(limiter.burst, limiter.tokens+now.Sub(limiter.last).Seconds()*limiter.rate)
+		limiter.last = now
+		if limiter.tokens >= 1 {
+			limiter.tokens--
+			limiter.mutex.Unlock()
+			return
+		}
+		wait := time.Duration((1 - limiter.tokens) / limiter.rate * float64(time.Second))
+		limiter.mutex.Unlock()
+		time.Sleep(wait)
+	}
+}
+
+// Holds off every request to the link's domain, used when a server sends Retry-After
+func blockDomain(link string, duration time.Duration) {
+	limiter := getDomainLimiter(getDownloadDomain(link))
+	limiter.mutex.Lock()
+	if until := time.Now().Add(duration); until.After(limiter.blockedUntil) {
+		limiter.blockedUntil = until
+	}
+	limiter.mutex.Unlock()
+}
+
+// Parses Retry-After as either seconds or an HTTP date, returns 0 if missing or invalid
+func parseRetryAfter(header http.Header) time.Duration {
+	value := strings.TrimSpace(header.Get("Retry-After"))
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		if wait := time.Until(date); wait > 0 {
+			return wait
+		}
+	}
+	return 0
+}
+
+// Delay before the next attempt; exponential with jitter unless the server asked for something specific
+func getDownloadBackoff(link string, attempt int, retryAfter time.Duration) time.Duration {
+	base, max := getDownloadBackoffLimits(link)
+	if retryAfter > 0 {
+		return clampRetryAfter(retryAfter, max)
+	}
+	delay := float64(base) * math.Pow(2, float64(attempt))
+	if max > 0 && delay > float64(max) {
+		delay = float64(max)
+	}
+	// Somewhere between half and the full delay
+	delay = delay/2 + rand.Float64()*delay/2
+	return time.Duration(delay * float64(time.Second))
+}
+
+// Base & max backoff in seconds, per domain if set
+func getDownloadBackoffLimits(link string) (base int, max int) {
+	config := getConfig()
+	base = config.DownloadRetryBackoff
+	max = config.DownloadRetryBackoffMax
+	if domainConfig := getDomainConfig(getDownloadDomain(link)); domainConfig != nil {
+		if domainConfig.RetryBackoff != nil {
+			base = *domainConfig.RetryBackoff
+		}
+		if domainConfig.RetryBackoffMax != nil {
+			max = *domainConfig.RetryBackoffMax
+		}
+	}
+	return base, max
+}
+
+// Servers can ask for any wait, it's capped at the max backoff so one reply can't stall a domain for days
+func clampRetryAfter(retryAfter time.Duration, max int) time.Duration {
+	if max > 0 && retryAfter > time.Duration(max)*time.Second {
+		return time.Duration(max) * time.Second
+	}
+	return retryAfter
+}
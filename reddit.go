@@ -0,0 +1,395 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	redditBaseURL      = "https://www.reddit.com"
+	redditMaxResponse  = 4 * 1024 * 1024
+	redditVideoBaseURL = "https://v.redd.it/"
+)
+
+// Resolves reddit posts, galleries and v.redd.it videos
+type redditExtractor struct{}
+
+func (e *redditExtractor) Name() string {
+	return "reddit"
+}
+
+func (e *redditExtractor) Match(link string) bool {
+	return regexUrlReddit.MatchString(link) ||
+		regexUrlRedditShort.MatchString(link) ||
+		regexUrlRedditVideo.MatchString(link)
+}
+
+func (e *redditExtractor) Extract(ctx context.Context, link string, channelID string) ([]*fileItem, error) {
+	if matches := regexUrlRedditVideo.FindStringSubmatch(link); matches != nil {
+		return getRedditVideoShortUrls(ctx, matches[2], channelID)
+	}
+	var postID string
+	if matches := regexUrlReddit.FindStringSubmatch(link); matches != nil {
+		postID = matches[4]
+	} else if matches := regexUrlRedditShort.FindStringSubmatch(link); matches != nil {
+		postID = matches[2]
+	} else {
+		return nil, nil
+	}
+	post, err := getRedditPost(ctx, postID)
+	if err != nil {
+		return nil, err
+	}
+	return getRedditPostUrls(ctx, post, channelID)
+}
+
+type redditListing struct {
+	Data struct {
+		Children []struct {
+			Data redditPost `json:"data"`
+		} `json:"children"`
+	} `json:"data"`
+}
+
+type redditPost struct {
+	ID               string                     `json:"id"`
+	Subreddit        string                     `json:"subreddit"`
+	URL              string                     `json:"url"`
+	IsVideo          bool                       `json:"is_video"`
+	IsGallery        bool                       `json:"is_gallery"`
+	Media            *redditMedia               `json:"media"`
+	SecureMedia      *redditMedia               `json:"secure_media"`
+	GalleryData      *redditGalleryData         `json:"gallery_data"`
+	MediaMetadata    map[string]redditMediaMeta `json:"media_metadata"`
+	CrosspostParents []redditPost               `json:"crosspost_parent_list"`
+	Created          float64                    `json:"created_utc"`
+}
+
+type redditMedia struct {
+	RedditVideo *redditVideo `json:"reddit_video"`
+}
+
+type redditVideo struct {
+	FallbackURL string `json:"fallback_url"`
+	DashURL     string `json:"dash_url"`
+	IsGif       bool   `json:"is_gif"`
+}
+
+type redditGalleryData struct {
+	Items []struct {
+		MediaID string `json:"media_id"`
+	} `json:"items"`
+}
+
+type redditMediaMeta struct {
+	Status string `json:"status"`
+	Type   string `json:"e"`
+	Mime   string `json:"m"`
+	Source struct {
+		URL string `json:"u"`
+		GIF string `json:"gif"`
+		MP4 string `json:"mp4"`
+	} `json:"s"`
+}
+
+// Reddit rejects requests using default library user agents
+func redditRequest(ctx context.Context, link string) (*http.Response, error) {
+	request, err := http.NewRequestWithContext(ctx, "GET", link, nil)
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("User-Agent", fmt.Sprintf("%s/%s", projectName, projectVersion))
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		response.Body.Close()
+		return nil, fmt.Errorf("reddit returned status %s", response.Status)
+	}
+	return response, nil
+}
+
+func getRedditPost(ctx context.Context, postID string) (*redditPost, error) {
+	response, err := redditRequest(ctx, redditBaseURL+"/comments/"+postID+"/.json?raw_json=1")
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	// The first listing holds the post, the second its comments
+	var listings []redditListing
+	err = json.NewDecoder(io.LimitReader(response.Body, redditMaxResponse)).Decode(&listings)
+	if err != nil {
+		return nil, err
+	}
+	if len(listings) == 0 || len(listings[0].Data.Children) == 0 {
+		return nil, errors.New("reddit post not found")
+	}
+	return &listings[0].Data.Children[0].Data, nil
+}
+
+func getRedditPostUrls(ctx context.Context, post *redditPost, channelID string) ([]*fileItem, error) {
+	// Crossposts keep their media on the original post
+	if len(post.CrosspostParents) > 0 && post.GalleryData == nil && post.Media == nil && post.SecureMedia == nil {
+		parent := post.CrosspostParents[0]
+		return getRedditPostUrls(ctx, &parent, channelID)
+	}
+
+	baseName := fmt.Sprintf("reddit %s - %s", post.Subreddit, post.ID)
+	postTime := time.Unix(int64(post.Created), 0)
+
+	if post.GalleryData != nil && len(post.GalleryData.Items) > 0 {
+		var items []*fileItem
+		for i, item := range post.GalleryData.Items {
+			meta, ok := post.MediaMetadata[item.MediaID]
+			if !ok || meta.Status != "valid" {
+				continue
+			}
+			link := getRedditGalleryItemURL(item.MediaID, meta)
+			if link == "" {
+				continue
+			}
+			items = append(items, &fileItem{
+				Link:     link,
+				Filename: fmt.Sprintf("%s %d%s", baseName, i+1, getRedditExtension(link)),
+				Time:     postTime,
+			})
+		}
+		if len(items) == 0 {
+			return nil, errors.New("reddit gallery has no available media")
+		}
+		return items, nil
+	}
+
+	media := post.SecureMedia
+	if media == nil {
+		media = post.Media
+	}
+	if media != nil && media.RedditVideo != nil {
+		items, err := getRedditVideoUrls(ctx, media.RedditVideo, baseName)
+		if err != nil {
+			return nil, err
+		}
+		for _, item := range items {
+			item.Time = postTime
+		}
+		return items, nil
+	}
+
+	if post.URL == "" {
+		return nil, nil
+	}
+	postURL, err := url.Parse(post.URL)
+	if err != nil {
+		return nil, err
+	}
+	if postURL.Host == "i.redd.it" {
+		return []*fileItem{{
+			Link:     post.URL,
+			Filename: baseName + getRedditExtension(post.URL),
+			Time:     postTime,
+		}}, nil
+	}
+	// Link posts point somewhere else, text posts point back at themselves
+	if strings.HasSuffix(postURL.Host, "reddit.com") || postURL.Host == "redd.it" {
+		return nil, nil
+	}
+	return getDownloadLinks(post.URL, channelID), nil
+}
+
+// Original gallery media lives on i.redd.it, previews on preview.redd.it are resized
+func getRedditGalleryItemURL(mediaID string, meta redditMediaMeta) string {
+	if meta.Type == "AnimatedImage" {
+		if meta.Source.MP4 != "" {
+			return html.UnescapeString(meta.Source.MP4)
+		}
+		return html.UnescapeString(meta.Source.GIF)
+	}
+	if meta.Mime != "" {
+		parts := strings.SplitN(meta.Mime, "/", 2)
+		if len(parts) == 2 {
+			extension := parts[1]
+			if extension == "jpeg" {
+				extension = "jpg"
+			}
+			return fmt.Sprintf("https://i.redd.it/%s.%s", mediaID, extension)
+		}
+	}
+	return html.UnescapeString(meta.Source.URL)
+}
+
+func getRedditExtension(link string) string {
+	parsed, err := url.Parse(link)
+	if err != nil {
+		return ""
+	}
+	return filepath.Ext(parsed.Path)
+}
+
+// v.redd.it links redirect to the post they belong to
+func getRedditVideoShortUrls(ctx context.Context, videoID string, channelID string) ([]*fileItem, error) {
+	response, err := redditRequest(ctx, redditVideoBaseURL+videoID)
+	if err != nil {
+		return nil, err
+	}
+	response.Body.Close()
+	if matches := regexUrlReddit.FindStringSubmatch(response.Request.URL.String()); matches != nil {
+		post, err := getRedditPost(ctx, matches[4])
+		if err != nil {
+			return nil, err
+		}
+		return getRedditPostUrls(ctx, post, channelID)
+	}
+	return getRedditVideoUrls(ctx, &redditVideo{
+		DashURL: redditVideoBaseURL + videoID + "/DASHPlaylist.mpd",
+	}, "reddit - "+videoID)
+}
+
+type redditDashManifest struct {
+	Periods []struct {
+		AdaptationSets []struct {
+			ContentType     string `xml:"contentType,attr"`
+			MimeType        string `xml:"mimeType,attr"`
+			Representations []struct {
+				Bandwidth int    `xml:"bandwidth,attr"`
+				MimeType  string `xml:"mimeType,attr"`
+				BaseURL   string `xml:"BaseURL"`
+			} `xml:"Representation"`
+		} `xml:"AdaptationSet"`
+	} `xml:"Period"`
+}
+
+// Reddit serves video and audio as separate DASH streams
+func getRedditVideoUrls(ctx context.Context, video *redditVideo, baseName string) ([]*fileItem, error) {
+	config := getConfig()
+	videoLink := html.UnescapeString(video.FallbackURL)
+	audioLink := ""
+
+	if video.DashURL != "" {
+		dashVideo, dashAudio, err := getRedditDashStreams(ctx, html.UnescapeString(video.DashURL))
+		if err == nil {
+			if dashVideo != "" {
+				videoLink = dashVideo
+			}
+			audioLink = dashAudio
+		} else if videoLink == "" {
+			return nil, err
+		}
+	}
+	if videoLink == "" {
+		return nil, errors.New("reddit video has no playable stream")
+	}
+	if video.IsGif {
+		audioLink = ""
+	}
+
+	items := []*fileItem{{
+		Link:     videoLink,
+		Filename: baseName + ".mp4",
+	}}
+	if audioLink != "" {
+		if config.FfmpegPath != "" {
+			items[0].AudioLink = audioLink
+		} else {
+			items = append(items, &fileItem{
+				Link:     audioLink,
+				Filename: baseName + " audio.mp4",
+			})
+		}
+	}
+	return items, nil
+}
+
+func getRedditDashStreams(ctx context.Context, dashURL string) (string, string, error) {
+	response, err := redditRequest(ctx, dashURL)
+	if err != nil {
+		return "", "", err
+	}
+	defer response.Body.Close()
+
+	var manifest redditDashManifest
+	err = xml.NewDecoder(io.LimitReader(response.Body, redditMaxResponse)).Decode(&manifest)
+	if err != nil {
+		return "", "", err
+	}
+
+	base, err := url.Parse(dashURL)
+	if err != nil {
+		return "", "", err
+	}
+	type stream struct {
+		link      string
+		bandwidth int
+	}
+	var videos, audios []stream
+	for _, period := range manifest.Periods {
+		for _, set := range period.AdaptationSets {
+			for _, representation := range set.Representations {
+				relative, err := url.Parse(strings.TrimSpace(representation.BaseURL))
+				if err != nil || representation.BaseURL == "" {
+					continue
+				}
+				s := stream{base.ResolveReference(relative).String(), representation.Bandwidth}
+				kind := set.ContentType + " " + set.MimeType + " " + representation.MimeType
+				if strings.Contains(kind, "audio") {
+					audios = append(audios, s)
+				} else {
+					videos = append(videos, s)
+				}
+			}
+		}
+	}
+	best := func(streams []stream) string {
+		if len(streams) == 0 {
+			return ""
+		}
+		sort.Slice(streams, func(i, j int) bool { return streams[i].bandwidth > streams[j].bandwidth })
+		return streams[0].link
+	}
+	return best(videos), best(audios), nil
+}
+
+// Combines a downloaded video stream with its separate audio stream, replacing the video file
+func muxRedditAudio(videoPath string, audioLink string) error {
+	config := getConfig()
+	timeout := time.Duration(config.DownloadTimeout) * time.Second
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	muxedFile, err := ioutil.TempFile(filepath.Dir(videoPath), ".mux-*.mp4")
+	if err != nil {
+		return err
+	}
+	muxedPath := muxedFile.Name()
+	muxedFile.Close()
+
+	cmd := exec.CommandContext(ctx, config.FfmpegPath,
+		"-y", "-loglevel", "error",
+		"-i", videoPath,
+		"-user_agent", fmt.Sprintf("%s/%s", projectName, projectVersion),
+		"-i", audioLink,
+		"-map", "0:v:0", "-map", "1:a:0",
+		"-c", "copy", "-f", "mp4",
+		muxedPath)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		os.Remove(muxedPath)
+		return fmt.Errorf("%s -- %s", err, strings.TrimSpace(string(output)))
+	}
+	return os.Rename(muxedPath, videoPath)
+}
@@ -27,6 +27,10 @@ const (
 	regexpUrlTistoryLegacy        = `^http(s?):\/\/[a-z0-9]+\.uf\.tistory\.com\/(image|original)\/[A-Z0-9]+$`
 	regexpUrlTistoryLegacyWithCDN = `^http(s)?:\/\/[0-9a-z]+.daumcdn.net\/[a-z]+\/[a-zA-Z0-9\.]+\/\?scode=mtistory&fname=http(s?)%3A%2F%2F[a-z0-9]+\.uf\.tistory\.com%2F(image|original)%2F[A-Z0-9]+$`
 	regexpUrlPossibleTistorySite  = `^http(s)?:\/\/[0-9a-zA-Z\.-]+\/(m\/)?(photo\/)?[0-9]+$`
+	regexpUrlReddit               = `^http(s?):\/\/(www\.|old\.|new\.|np\.)?reddit\.com\/(r\/[A-Za-z0-9_]+\/comments|comments|gallery)\/([a-z0-9]+)(\/[^?#]*)?(\?[^#]*)?$`
+	regexpUrlRedditShort          = `^http(s?):\/\/redd\.it\/([a-z0-9]+)\/?$`
+	regexpUrlRedditVideo          = `^http(s?):\/\/v\.redd\.it\/([A-Za-z0-9]+)\/?$`
+	regexpTemplateVariable        = `\{([A-Za-z]+)\}`
 )
 
 var (
@@ -51,6 +55,10 @@ var (
 	regexUrlTistoryLegacy        *regexp.Regexp
 	regexUrlTistoryLegacyWithCDN *regexp.Regexp
 	regexUrlPossibleTistorySite  *regexp.Regexp
+	regexUrlReddit               *regexp.Regexp
+	regexUrlRedditShort          *regexp.Regexp
+	regexUrlRedditVideo          *regexp.Regexp
+	regexTemplateVariable        *regexp.Regexp
 )
 
 func compileRegex() error {
@@ -140,6 +148,22 @@ func compileRegex() error {
 	if err != nil {
 		return err
 	}
+	regexUrlReddit, err = regexp.Compile(regexpUrlReddit)
+	if err != nil {
+		return err
+	}
+	regexUrlRedditShort, err = regexp.Compile(regexpUrlRedditShort)
+	if err != nil {
+		return err
+	}
+	regexUrlRedditVideo, err = regexp.Compile(regexpUrlRedditVideo)
+	if err != nil {
+		return err
+	}
+	regexTemplateVariable, err = regexp.Compile(regexpTemplateVariable)
+	if err != nil {
+		return err
+	}
 
 	return nil
 }
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/fatih/color"
+)
+
+const configWatchInterval = 5 * time.Second
+
+var (
+	errNoCredentials = errors.New("no valid discord login found, token, email and password are all invalid")
+
+	configReloadMutex sync.Mutex
+	configModTime     time.Time // of the settings file currently in use
+)
+
+func getConfigModTime() time.Time {
+	if info, err := os.Stat(configPath); err == nil {
+		return info.ModTime()
+	}
+	return time.Time{}
+}
+
+// Re-reads the settings file and swaps it in, the settings in use are kept if the new ones are invalid.
+// Returns notes on changes that needed more than swapping.
+func reloadConfig() ([]string, error) {
+	configReloadMutex.Lock()
+	defer configReloadMutex.Unlock()
+
+	modTime := getConfigModTime()
+	newConfig, warnings, err := readConfig(configPath)
+	for _, warning := range warnings {
+		log.Println(color.YellowString("Settings warning: %s", warning))
+	}
+	if err != nil {
+		// Not retried by the watcher until the file changes again
+		configModTime = modTime
+		return nil, err
+	}
+	oldConfig := currentConfig.Swap(newConfig)
+	configModTime = modTime
+	log.Println(color.HiYellowString("Settings reloaded, bound to %d channel(s)", getBoundChannelsCount()))
+	logConfig()
+
+	return append(warnings, applyConfigChanges(oldConfig, newConfig)...), nil
+}
+
+// Redoes the setup main does at startup for settings that aren't just read when needed
+func applyConfigChanges(oldConfig *configuration, newConfig *configuration) []string {
+	var notes []string
+	oldCredentials, newCredentials := oldConfig.Credentials, newConfig.Credentials
+
+	if newCredentials.Token != oldCredentials.Token || newCredentials.Email != oldCredentials.Email ||
+		newCredentials.Password != oldCredentials.Password || newConfig.MessageContentIntent != oldConfig.MessageContentIntent {
+		log.Println(color.YellowString("Discord credentials or intents changed, reconnecting..."))
+		if err := reconnectDiscord(); err != nil {
+			log.Println(color.HiRedString("Failed to reconnect to Discord:\t%s", err))
+			notes = append(notes, fmt.Sprintf("Failed to reconnect to Discord with the new settings: %s", err))
+		} else {
+			notes = append(notes, "Reconnected to Discord with the new settings.")
+		}
+	}
+	if newCredentials.TwitterAccessToken != oldCredentials.TwitterAccessToken ||
+		newCredentials.TwitterAccessTokenSecret != oldCredentials.TwitterAccessTokenSecret ||
+		newCredentials.TwitterConsumerKey != oldCredentials.TwitterConsumerKey ||
+		newCredentials.TwitterConsumerSecret != oldCredentials.TwitterConsumerSecret {
+		connectTwitter()
+		notes = append(notes, "Reconnected to the Twitter API.")
+	}
+	if newCredentials.GoogleDriveCredentialsJSON != oldCredentials.GoogleDriveCredentialsJSON {
+		connectGoogleDrive()
+		notes = append(notes, "Reconnected to Google Drive.")
+	}
+
+	if newConfig.FilterDuplicateImages && imgStore == nil {
+		loadImgStore()
+	}
+	if newConfig.DownloadWorkers != oldConfig.DownloadWorkers {
+		notes = append(notes, "The number of download workers changes after a restart.")
+	}
+	if !reflect.DeepEqual(newConfig.Channels, oldConfig.Channels) {
+		// Newly registered channels start catching up from now
+		go catchUpMissedMessages()
+	}
+	updateDiscordPresence()
+	return notes
+}
+
+// Reloads settings whenever the file is saved, while watchSettings is on
+func watchConfig() {
+	logPrefixHere := color.CyanString("[watchConfig]")
+	ticker := time.NewTicker(configWatchInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		if !getConfig().WatchSettings {
+			continue
+		}
+		modTime := getConfigModTime()
+		configReloadMutex.Lock()
+		changed := !modTime.IsZero() && !modTime.Equal(configModTime)
+		configReloadMutex.Unlock()
+		if !changed {
+			continue
+		}
+
+		log.Println(logPrefixHere, color.YellowString("\"%s\" changed, reloading settings...", configPath))
+		notes, err := reloadConfig()
+		if err != nil {
+			log.Println(logPrefixHere, color.HiRedString("Settings were not reloaded, still using the previous settings:\t%s", err))
+			sendAdminChannelsEmbed("Settings — Reload Failed", fmt.Sprintf(
+				"``%s`` was changed but couldn't be used, still using the previous settings.\n```%s```", configPath, err))
+			continue
+		}
+		for _, note := range notes {
+			log.Println(logPrefixHere, color.YellowString("%s", note))
+		}
+	}
+}
+
+// Posts an embed to every admin channel
+func sendAdminChannelsEmbed(title string, description string) {
+	config := getConfig()
+	if bot == nil {
+		return
+	}
+	for _, item := range config.AdminChannels {
+		if _, err := bot.ChannelMessageSendEmbed(item.ChannelID, buildEmbed(item.ChannelID, title, description)); err != nil {
+			log.Println(color.HiRedString("Failed to send message to admin channel %s:\t%s", item.ChannelID, err))
+		}
+	}
+}
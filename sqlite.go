@@ -0,0 +1,362 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/fatih/color"
+	_ "modernc.org/sqlite"
+)
+
+// Each entry upgrades the schema by one version, tracked with PRAGMA user_version.
+// Only ever append to this list.
+var sqliteMigrations = []string{
+	`CREATE TABLE downloads (
+		id          INTEGER PRIMARY KEY AUTOINCREMENT,
+		url         TEXT NOT NULL,
+		time        TEXT NOT NULL,
+		destination TEXT NOT NULL DEFAULT '',
+		filename    TEXT NOT NULL DEFAULT '',
+		channel_id  TEXT NOT NULL DEFAULT '',
+		user_id     TEXT NOT NULL DEFAULT ''
+	);
+	CREATE INDEX downloads_url ON downloads (url);
+	CREATE INDEX downloads_channel_id ON downloads (channel_id);
+	CREATE INDEX downloads_user_id ON downloads (user_id);
+	CREATE TABLE queue (
+		id  INTEGER PRIMARY KEY AUTOINCREMENT,
+		job TEXT NOT NULL
+	);`,
+	`ALTER TABLE downloads ADD COLUMN source_url TEXT NOT NULL DEFAULT '';
+	ALTER TABLE downloads ADD COLUMN message_id TEXT NOT NULL DEFAULT '';
+	ALTER TABLE downloads ADD COLUMN guild_id TEXT NOT NULL DEFAULT '';
+	ALTER TABLE downloads ADD COLUMN size INTEGER NOT NULL DEFAULT 0;
+	ALTER TABLE downloads ADD COLUMN content_type TEXT NOT NULL DEFAULT '';
+	ALTER TABLE downloads ADD COLUMN hash TEXT NOT NULL DEFAULT '';
+	ALTER TABLE downloads ADD COLUMN extractor TEXT NOT NULL DEFAULT '';
+	ALTER TABLE downloads ADD COLUMN duration_ms INTEGER NOT NULL DEFAULT 0;
+	CREATE INDEX downloads_message_id ON downloads (message_id);
+	CREATE INDEX downloads_guild_id ON downloads (guild_id);`,
+	`ALTER TABLE downloads ADD COLUMN duplicate_of INTEGER NOT NULL DEFAULT 0;
+	ALTER TABLE downloads ADD COLUMN duplicate_policy TEXT NOT NULL DEFAULT '';
+	CREATE INDEX downloads_hash ON downloads (hash);`,
+	`CREATE TABLE history_checkpoints (
+		channel_id TEXT PRIMARY KEY,
+		newest_id  TEXT NOT NULL DEFAULT '',
+		oldest_id  TEXT NOT NULL DEFAULT '',
+		complete   INTEGER NOT NULL DEFAULT 0,
+		updated    TEXT NOT NULL DEFAULT ''
+	);`,
+	`CREATE TABLE channel_last_seen (
+		channel_id TEXT PRIMARY KEY,
+		message_id TEXT NOT NULL
+	);`,
+	`CREATE TABLE imports (
+		name TEXT PRIMARY KEY,
+		time TEXT NOT NULL
+	);`,
+}
+
+const sqliteDownloadColumns = `url, source_url, time, destination, filename, channel_id, user_id,
+	message_id, guild_id, size, content_type, hash, extractor, duration_ms, duplicate_of, duplicate_policy`
+
+type sqliteDatabase struct {
+	db *sql.DB
+}
+
+func openSqliteDatabase(path string) (*sqliteDatabase, error) {
+	db, err := sql.Open("sqlite", "file:"+path+"?_pragma=busy_timeout(10000)&_pragma=journal_mode(WAL)")
+	if err != nil {
+		return nil, err
+	}
+	// SQLite allows a single writer, download workers take turns instead of failing with "database is locked"
+	db.SetMaxOpenConns(1)
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	store := &sqliteDatabase{db: db}
+	if err := store.migrate(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return store, nil
+}
+
+func (s *sqliteDatabase) migrate() error {
+	var version int
+	if err := s.db.QueryRow(`PRAGMA user_version`).Scan(&version); err != nil {
+		return err
+	}
+	for ; version < len(sqliteMigrations); version++ {
+		tx, err := s.db.Begin()
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(sqliteMigrations[version]); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("database schema upgrade %d failed: %s", version+1, err)
+		}
+		if _, err := tx.Exec(fmt.Sprintf(`PRAGMA user_version = %d`, version+1)); err != nil {
+			tx.Rollback()
+			return err
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *sqliteDatabase) Close() error {
+	return s.db.Close()
+}
+
+func (s *sqliteDatabase) InsertDownload(download *download) error {
+	result, err := s.db.Exec(`INSERT INTO downloads (`+sqliteDownloadColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		download.URL, download.SourceURL, download.Time.Format(time.RFC3339Nano), download.Destination, download.Filename,
+		download.ChannelID, download.UserID, download.MessageID, download.GuildID, download.Size, download.ContentType,
+		download.Hash, download.Extractor, download.Duration.Milliseconds(), download.DuplicateOf, download.DuplicatePolicy)
+	if err != nil {
+		return err
+	}
+	download.ID, err = result.LastInsertId()
+	return err
+}
+
+func (s *sqliteDatabase) findDownloads(where string, args ...interface{}) ([]*download, error) {
+	rows, err := s.db.Query(`SELECT id, `+sqliteDownloadColumns+` FROM downloads WHERE `+where, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	downloads := make([]*download, 0)
+	for rows.Next() {
+		var timeString string
+		var durationMs int64
+		item := new(download)
+		err := rows.Scan(&item.ID, &item.URL, &item.SourceURL, &timeString, &item.Destination, &item.Filename,
+			&item.ChannelID, &item.UserID, &item.MessageID, &item.GuildID, &item.Size, &item.ContentType,
+			&item.Hash, &item.Extractor, &durationMs, &item.DuplicateOf, &item.DuplicatePolicy)
+		if err != nil {
+			return downloads, err
+		}
+		item.Time, _ = time.Parse(time.RFC3339Nano, timeString)
+		item.Duration = time.Duration(durationMs) * time.Millisecond
+		downloads = append(downloads, item)
+	}
+	return downloads, rows.Err()
+}
+
+func (s *sqliteDatabase) FindDownloadsByURL(inputURL string) ([]*download, error) {
+	return s.findDownloads(`url = ?`, inputURL)
+}
+
+// Originals first, so links point at the file that was actually downloaded
+func (s *sqliteDatabase) FindDownloadsByHash(hash string) ([]*download, error) {
+	return s.findDownloads(`hash = ? ORDER BY duplicate_of != 0, id`, hash)
+}
+
+func (s *sqliteDatabase) DuplicateStats() (int, int64, error) {
+	var count int
+	var size int64
+	err := s.db.QueryRow(`SELECT COUNT(*), COALESCE(SUM(size), 0) FROM downloads WHERE duplicate_of != 0 AND duplicate_policy != ?`,
+		duplicatePolicySave).Scan(&count, &size)
+	return count, size, err
+}
+
+func (s *sqliteDatabase) count(query string, args ...interface{}) (int, error) {
+	var count int
+	err := s.db.QueryRow(query, args...).Scan(&count)
+	return count, err
+}
+
+func (s *sqliteDatabase) DownloadCount() (int, error) {
+	return s.count(`SELECT COUNT(*) FROM downloads`)
+}
+
+func (s *sqliteDatabase) DownloadCountByChannel(channelID string) (int, error) {
+	return s.count(`SELECT COUNT(*) FROM downloads WHERE channel_id = ?`, channelID)
+}
+
+func (s *sqliteDatabase) DownloadCountByUser(userID string) (int, error) {
+	return s.count(`SELECT COUNT(*) FROM downloads WHERE user_id = ?`, userID)
+}
+
+func (s *sqliteDatabase) FindDownloads(filter downloadFilter) ([]*download, error) {
+	where := `1`
+	var args []interface{}
+	if filter.ChannelID != "" {
+		where += ` AND channel_id = ?`
+		args = append(args, filter.ChannelID)
+	}
+	if filter.UserID != "" {
+		where += ` AND user_id = ?`
+		args = append(args, filter.UserID)
+	}
+	downloads, err := s.findDownloads(where+` ORDER BY id`, args...)
+	if err != nil {
+		return nil, err
+	}
+	// Times are stored as text with their original zone, compare them here rather than in SQL
+	filtered := make([]*download, 0, len(downloads))
+	for _, item := range downloads {
+		if filter.matches(item) {
+			filtered = append(filtered, item)
+		}
+	}
+	return filtered, nil
+}
+
+// Inserts records from another database in one transaction, skipping any URL already downloaded
+// for the same channel. IDs are reassigned and duplicate relations remapped to the new IDs.
+func (s *sqliteDatabase) ImportDownloads(downloads []*download) (int, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	imported := 0
+	newIDs := make(map[int64]int64)
+	for _, item := range downloads {
+		var existingID int64
+		err := tx.QueryRow(`SELECT id FROM downloads WHERE url = ? AND channel_id = ? LIMIT 1`, item.URL, item.ChannelID).Scan(&existingID)
+		if err == nil {
+			if item.ID != 0 {
+				newIDs[item.ID] = existingID
+			}
+			continue
+		} else if err != sql.ErrNoRows {
+			tx.Rollback()
+			return 0, err
+		}
+		duplicateOf := newIDs[item.DuplicateOf]
+		result, err := tx.Exec(`INSERT INTO downloads (`+sqliteDownloadColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			item.URL, item.SourceURL, item.Time.Format(time.RFC3339Nano), item.Destination, item.Filename,
+			item.ChannelID, item.UserID, item.MessageID, item.GuildID, item.Size, item.ContentType,
+			item.Hash, item.Extractor, item.Duration.Milliseconds(), duplicateOf, item.DuplicatePolicy)
+		if err != nil {
+			tx.Rollback()
+			return 0, err
+		}
+		if item.ID != 0 {
+			newIDs[item.ID], _ = result.LastInsertId()
+		}
+		imported++
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return imported, nil
+}
+
+func (s *sqliteDatabase) DeleteDownload(id int64) error {
+	_, err := s.db.Exec(`DELETE FROM downloads WHERE id = ?`, id)
+	return err
+}
+
+func (s *sqliteDatabase) FindHistoryCheckpoint(channelID string) (*historyCheckpoint, error) {
+	var updated string
+	checkpoint := &historyCheckpoint{ChannelID: channelID}
+	err := s.db.QueryRow(`SELECT newest_id, oldest_id, complete, updated FROM history_checkpoints WHERE channel_id = ?`, channelID).
+		Scan(&checkpoint.NewestID, &checkpoint.OldestID, &checkpoint.Complete, &updated)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	checkpoint.Updated, _ = time.Parse(time.RFC3339Nano, updated)
+	return checkpoint, nil
+}
+
+func (s *sqliteDatabase) SaveHistoryCheckpoint(checkpoint *historyCheckpoint) error {
+	_, err := s.db.Exec(`INSERT INTO history_checkpoints (channel_id, newest_id, oldest_id, complete, updated) VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT (channel_id) DO UPDATE SET newest_id = excluded.newest_id, oldest_id = excluded.oldest_id,
+		complete = excluded.complete, updated = excluded.updated`,
+		checkpoint.ChannelID, checkpoint.NewestID, checkpoint.OldestID, checkpoint.Complete, checkpoint.Updated.Format(time.RFC3339Nano))
+	return err
+}
+
+func (s *sqliteDatabase) DeleteHistoryCheckpoint(channelID string) error {
+	_, err := s.db.Exec(`DELETE FROM history_checkpoints WHERE channel_id = ?`, channelID)
+	return err
+}
+
+func (s *sqliteDatabase) FindLastSeenMessage(channelID string) (string, error) {
+	var messageID string
+	err := s.db.QueryRow(`SELECT message_id FROM channel_last_seen WHERE channel_id = ?`, channelID).Scan(&messageID)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return messageID, err
+}
+
+// Only ever moves forward, messages can be handled out of order
+func (s *sqliteDatabase) SaveLastSeenMessage(channelID string, messageID string) error {
+	_, err := s.db.Exec(`INSERT INTO channel_last_seen (channel_id, message_id) VALUES (?, ?)
+		ON CONFLICT (channel_id) DO UPDATE SET message_id = excluded.message_id
+		WHERE length(excluded.message_id) > length(message_id)
+		OR (length(excluded.message_id) = length(message_id) AND excluded.message_id > message_id)`,
+		channelID, messageID)
+	return err
+}
+
+func (s *sqliteDatabase) InsertQueuedDownload(job *downloadJob) (int, error) {
+	jobJSON, err := json.Marshal(job)
+	if err != nil {
+		return 0, err
+	}
+	result, err := s.db.Exec(`INSERT INTO queue (job) VALUES (?)`, string(jobJSON))
+	if err != nil {
+		return 0, err
+	}
+	id, err := result.LastInsertId()
+	return int(id), err
+}
+
+func (s *sqliteDatabase) DeleteQueuedDownload(id int) error {
+	_, err := s.db.Exec(`DELETE FROM queue WHERE id = ?`, id)
+	return err
+}
+
+func (s *sqliteDatabase) FindQueuedDownloads() ([]*downloadJob, error) {
+	rows, err := s.db.Query(`SELECT id, job FROM queue ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+
+	jobs := make([]*downloadJob, 0)
+	var unusable []int // can't ever be downloaded, e.g. queued by an older version
+	for rows.Next() {
+		var id int
+		var jobJSON string
+		if err := rows.Scan(&id, &jobJSON); err != nil {
+			rows.Close()
+			return jobs, err
+		}
+		job := new(downloadJob)
+		if err := json.Unmarshal([]byte(jobJSON), job); err != nil {
+			log.Println(color.HiRedString("Failed to decode queued download %d, removing it:\t%s", id, err))
+			unusable = append(unusable, id)
+			continue
+		}
+		if job.File == nil || job.Message == nil {
+			log.Println(color.HiRedString("Queued download %d is incomplete, removing it", id))
+			unusable = append(unusable, id)
+			continue
+		}
+		job.id = id
+		jobs = append(jobs, job)
+	}
+	err = rows.Err()
+	rows.Close()
+	for _, id := range unusable {
+		if err := s.DeleteQueuedDownload(id); err != nil {
+			log.Println(color.HiRedString("Failed to remove queued download %d:\t%s", id, err))
+		}
+	}
+	return jobs, err
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// Returns the channel's pathTemplate, or the layout its divideFoldersBy settings describe
+func getPathTemplate(channelConfig configurationChannel) string {
+	if channelConfig.PathTemplate != nil {
+		return *channelConfig.PathTemplate
+	}
+	var folders []string
+	if channelConfig.DivideFoldersByServer != nil && *channelConfig.DivideFoldersByServer {
+		folders = append(folders, "{guild}")
+	}
+	if channelConfig.DivideFoldersByChannel != nil && *channelConfig.DivideFoldersByChannel {
+		folders = append(folders, "{channel}", "{thread}")
+	}
+	if channelConfig.DivideFoldersByUser != nil && *channelConfig.DivideFoldersByUser {
+		folders = append(folders, "{author}")
+	}
+	if channelConfig.DivideFoldersByType != nil && *channelConfig.DivideFoldersByType {
+		folders = append(folders, "{typeFolder}")
+	}
+	return strings.Join(folders, "/")
+}
+
+// Returns the channel's filenameTemplate, or the date prefix the bot has always used
+func getFilenameTemplate(channelConfig configurationChannel) string {
+	if channelConfig.FilenameTemplate != nil {
+		return *channelConfig.FilenameTemplate
+	}
+	return "{date}{filename}"
+}
+
+const (
+	dateSourceMessage      = "message"
+	dateSourceDownload     = "download"
+	dateSourceLastModified = "lastModified"
+)
+
+// Picks the date used for file names, templates & file metadata by the channel's dateSource.
+// Discord & HTTP dates are UTC, names use local time like downloads always have.
+func getFileDate(channelConfig configurationChannel, messageTime time.Time, lastModified time.Time) time.Time {
+	dateSource := dateSourceMessage
+	if channelConfig.DateSource != nil {
+		dateSource = *channelConfig.DateSource
+	}
+	switch dateSource {
+	case dateSourceDownload:
+		return time.Now()
+	case dateSourceLastModified:
+		if !lastModified.IsZero() {
+			return lastModified.Local()
+		}
+	}
+	if messageTime.IsZero() {
+		return time.Now()
+	}
+	return messageTime.Local()
+}
+
+func getFilenameDateFormat(channelConfig configurationChannel) string {
+	config := getConfig()
+	if channelConfig.OverwriteFilenameDateFormat != nil && *channelConfig.OverwriteFilenameDateFormat != "" {
+		return *channelConfig.OverwriteFilenameDateFormat
+	}
+	return config.FilenameDateFormat
+}
+
+// Folder names the content type division has always used
+func getContentTypeFolder(contentTypeFound string) string {
+	switch contentTypeFound {
+	case "image":
+		return "images"
+	case "video":
+		return "videos"
+	case "audio":
+		return "audio"
+	case "text":
+		return "text"
+	case "application":
+		return "applications"
+	}
+	return ""
+}
+
+func getTemplateValues(file *fileItem, filename string, contentTypeFound string, fileTime time.Time,
+	message *discordgo.Message) map[string]string {
+	channelConfig := getChannelConfig(message.ChannelID)
+	dateFormat := getFilenameDateFormat(channelConfig)
+	// Threads & forum posts go by the channel they're in, with the thread on its own
+	channelID := message.ChannelID
+	thread, threadID := "", ""
+	if parentID := getThreadParentID(message.ChannelID); parentID != "" {
+		channelID = parentID
+		thread, threadID = getThreadName(message.ChannelID), message.ChannelID
+	}
+	sourceGuildName, sourceChannelName := getSourceNames(channelID)
+	if sourceGuildName == "Unavailable" {
+		sourceGuildName = ""
+	}
+	// Names have always been cleaned of anything a path can't have on any system, keeping folders the same everywhere
+	sourceGuildName = removeFromString(sourceGuildName, pathBlacklist)
+	sourceChannelName = removeFromString(sourceChannelName, pathBlacklist)
+	thread = removeFromString(thread, pathBlacklist)
+
+	author := ""
+	authorID := ""
+	if message.Author != nil {
+		author = message.Author.ID
+		authorID = message.Author.ID
+		if message.Author.Username != "" {
+			author = removeFromString(message.Author.Username+"#"+message.Author.Discriminator, pathBlacklist)
+		}
+	}
+
+	extension := filepath.Ext(filename)
+	return map[string]string{
+		"guild":        sourceGuildName,
+		"guildID":      message.GuildID,
+		"channel":      sourceChannelName,
+		"channelID":    channelID,
+		"thread":       thread,
+		"threadID":     threadID,
+		"author":       author,
+		"authorID":     authorID,
+		"messageID":    message.ID,
+		"date":         fileTime.Format(dateFormat),
+		"yyyy":         fileTime.Format("2006"),
+		"mm":           fileTime.Format("01"),
+		"dd":           fileTime.Format("02"),
+		"hour":         fileTime.Format("15"),
+		"minute":       fileTime.Format("04"),
+		"second":       fileTime.Format("05"),
+		"downloadDate": time.Now().Format(dateFormat),
+		"contentType":  contentTypeFound,
+		"typeFolder":   getContentTypeFolder(contentTypeFound),
+		"extractor":    file.Extractor,
+		"filename":     filename,
+		"name":         strings.TrimSuffix(filename, extension),
+		"ext":          strings.TrimPrefix(extension, "."),
+		"index":        strconv.Itoa(file.Index),
+	}
+}
+
+// Fills in {variables}, "/" separates folders and empty folders are left out.
+// Values only lose characters file names can't have, so dates keep their ":" where the system allows it.
+// Unknown variables are kept as they are so typos show up in the saved path.
+func applyPathTemplate(template string, values map[string]string) string {
+	var segments []string
+	for _, segment := range strings.FieldsFunc(template, func(r rune) bool { return r == '/' || r == os.PathSeparator }) {
+		segment = regexTemplateVariable.ReplaceAllStringFunc(segment, func(match string) string {
+			value, exists := values[match[1:len(match)-1]]
+			if !exists {
+				return match
+			}
+			// Only the template's own "/" make folders
+			return removeFromString(value, filenameBlacklist)
+		})
+		segment = strings.TrimSpace(segment)
+		if segment != "" && segment != "." && segment != ".." {
+			segments = append(segments, segment)
+		}
+	}
+	return strings.Join(segments, string(os.PathSeparator))
+}
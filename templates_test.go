@@ -0,0 +1,47 @@
+package main
+
+import (
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestApplyPathTemplate(t *testing.T) {
+	if err := compileRegex(); err != nil {
+		t.Fatal(err)
+	}
+	values := map[string]string{
+		"guild":    "Server",
+		"channel":  "general",
+		"thread":   "",
+		"date":     "2021-05-04 13:37:00 ",
+		"filename": "image.png",
+		"slashed":  "a/b",
+	}
+	tests := []struct {
+		name       string
+		template   string
+		want       string
+		notWindows bool // ":" can't be in file names there
+	}{
+		{"folders", "{guild}/{channel}", filepath.Join("Server", "general"), false},
+		{"empty folder left out", "{guild}/{thread}/{channel}", filepath.Join("Server", "general"), false},
+		{"unknown variable kept", "{guild}/{nope}", filepath.Join("Server", "{nope}"), false},
+		{"text around variables", "saved-{channel}/x", filepath.Join("saved-general", "x"), false},
+		{"date keeps colons", "{date}{filename}", "2021-05-04 13:37:00 image.png", true},
+		{"slash in value is not a folder", "{slashed}/{filename}", filepath.Join("ab", "image.png"), false},
+		{"dot folders dropped", "./../{channel}", "general", false},
+		{"surrounding space trimmed", " {guild} / {channel} ", filepath.Join("Server", "general"), false},
+		{"empty template", "", "", false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if test.notWindows && runtime.GOOS == "windows" {
+				t.Skip()
+			}
+			if got := applyPathTemplate(test.template, values); got != test.want {
+				t.Errorf("applyPathTemplate(%q) = %q, want %q", test.template, got, test.want)
+			}
+		})
+	}
+}
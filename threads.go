@@ -0,0 +1,172 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/fatih/color"
+)
+
+// How long a channel Discord wouldn't give us is left alone before asking again
+const channelLookupRetry = 10 * time.Minute
+
+var (
+	// Thread ID -> parent channel ID, "" for channels that aren't threads. Threads never move.
+	threadParents      = make(map[string]string)
+	threadParentsMutex sync.Mutex
+
+	// Channel ID -> when it can be requested again after failing
+	channelLookupFailures      = make(map[string]time.Time)
+	channelLookupFailuresMutex sync.Mutex
+)
+
+// Looks a channel up in state, asking Discord when it isn't there (archived threads usually aren't).
+// Not for every message, use getStateChannel there.
+func getChannel(channelID string) (*discordgo.Channel, error) {
+	if channel, err := getStateChannel(channelID); err == nil {
+		return channel, nil
+	}
+	channelLookupFailuresMutex.Lock()
+	retry, failed := channelLookupFailures[channelID]
+	channelLookupFailuresMutex.Unlock()
+	if failed && time.Now().Before(retry) {
+		return nil, fmt.Errorf("channel %s unavailable", channelID)
+	}
+
+	channel, err := bot.Channel(channelID)
+	channelLookupFailuresMutex.Lock()
+	if err != nil {
+		channelLookupFailures[channelID] = time.Now().Add(channelLookupRetry)
+	} else {
+		delete(channelLookupFailures, channelID)
+	}
+	channelLookupFailuresMutex.Unlock()
+	return channel, err
+}
+
+// Looks a channel up in state only, threads are added as they're created or have messages posted
+func getStateChannel(channelID string) (*discordgo.Channel, error) {
+	if bot == nil || bot.State == nil {
+		return nil, fmt.Errorf("not connected")
+	}
+	return bot.State.Channel(channelID)
+}
+
+// The channel a thread or forum post was started in, "" for anything else.
+// Checked for every message so only state is used, archived threads are added by history as it finds them.
+func getThreadParentID(channelID string) string {
+	threadParentsMutex.Lock()
+	parentID, known := threadParents[channelID]
+	threadParentsMutex.Unlock()
+	if known {
+		return parentID
+	}
+
+	channel, err := getStateChannel(channelID)
+	if err != nil {
+		return "" // state may still learn of it
+	}
+	if channel.IsThread() {
+		parentID = channel.ParentID
+	}
+	threadParentsMutex.Lock()
+	threadParents[channelID] = parentID
+	threadParentsMutex.Unlock()
+	return parentID
+}
+
+// Whether a registered channel's settings carry over to its threads, forum channels use includeForumPosts
+func isIncludingThreads(channelID string, channelConfig configurationChannel) bool {
+	if channel, err := getStateChannel(channelID); err == nil && channel.Type == discordgo.ChannelTypeGuildForum {
+		return channelConfig.IncludeForumPosts != nil && *channelConfig.IncludeForumPosts
+	}
+	return channelConfig.IncludeThreads != nil && *channelConfig.IncludeThreads
+}
+
+// Config of the registered channel a thread is in, if that channel includes its threads
+func getThreadChannelConfig(channelID string) (configurationChannel, bool) {
+	parentID := getThreadParentID(channelID)
+	if parentID == "" {
+		return configurationChannel{}, false
+	}
+	channelConfig, found := resolveChannelConfig(parentID)
+	if !found || !isIncludingThreads(parentID, channelConfig) {
+		return configurationChannel{}, false
+	}
+	return channelConfig, true
+}
+
+// Every thread in a channel for history, active first then archived public & private ones
+func getChannelThreads(channelID string) []string {
+	logPrefixHere := color.CyanString("[getChannelThreads]")
+	channel, err := getChannel(channelID)
+	if err != nil {
+		log.Println(logPrefixHere, color.HiRedString("Failed to fetch channel %s:\t%s", channelID, err))
+		return nil
+	}
+
+	var threads []string
+	addThreads := func(list []*discordgo.Channel) {
+		for _, thread := range list {
+			if thread.ParentID != channelID || stringInSlice(thread.ID, threads) {
+				continue
+			}
+			threadParentsMutex.Lock()
+			threadParents[thread.ID] = channelID
+			threadParentsMutex.Unlock()
+			threads = append(threads, thread.ID)
+		}
+	}
+
+	// Active threads are only listed for the whole server
+	if channel.GuildID != "" {
+		if active, err := bot.GuildThreadsActive(channel.GuildID); err != nil {
+			log.Println(logPrefixHere, color.HiRedString("Failed to request active threads for %s:\t%s", channelID, err))
+		} else {
+			addThreads(active.Threads)
+		}
+	}
+
+	archived := []struct {
+		name    string
+		request func(channelID string, before *time.Time, limit int, options ...discordgo.RequestOption) (*discordgo.ThreadsList, error)
+	}{
+		{"public", bot.ThreadsArchived},
+		{"private", bot.ThreadsPrivateArchived}, // needs Manage Threads
+	}
+	for _, kind := range archived {
+		var before *time.Time
+		for {
+			list, err := kind.request(channelID, before, 100)
+			if err != nil {
+				log.Println(logPrefixHere, color.YellowString("Unable to request archived %s threads for %s:\t%s", kind.name, channelID, err))
+				break
+			}
+			addThreads(list.Threads)
+			if !list.HasMore || len(list.Threads) == 0 {
+				break
+			}
+			last := list.Threads[len(list.Threads)-1]
+			if last.ThreadMetadata == nil {
+				break
+			}
+			archiveTime := last.ThreadMetadata.ArchiveTimestamp
+			before = &archiveTime
+		}
+	}
+	return threads
+}
+
+// Name of the thread a message is in, "" when it isn't in one. Called for every download, so only the state is asked
+func getThreadName(channelID string) string {
+	if getThreadParentID(channelID) == "" {
+		return ""
+	}
+	if channel, err := getStateChannel(channelID); err == nil {
+		return channel.Name
+	}
+	return ""
+}
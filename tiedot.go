@@ -0,0 +1,150 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/HouzuoGuo/tiedot/db"
+	"github.com/fatih/color"
+)
+
+// Collections used by versions before the SQLite database
+var tiedotCollections = []string{"Downloads", "Queue"}
+
+func hasTiedotDatabase() bool {
+	for _, collection := range tiedotCollections {
+		if info, err := os.Stat(filepath.Join(databasePath, collection)); err == nil && info.IsDir() {
+			return true
+		}
+	}
+	return false
+}
+
+// tiedot stored times with time.String(), which may include a monotonic clock reading
+func parseTiedotTime(value string) time.Time {
+	if i := strings.Index(value, " m="); i != -1 {
+		value = value[:i]
+	}
+	parsed, _ := time.Parse("2006-01-02 15:04:05.999999999 -0700 MST", value)
+	return parsed
+}
+
+const tiedotImportName = "tiedot"
+
+// Copies everything from the old tiedot database, then moves its collections
+// out of the way so this only happens once. The import is recorded along with the records,
+// if moving the collections fails it's only retried the next time, not imported again.
+func migrateTiedotDatabase(store *sqliteDatabase) error {
+	if !hasTiedotDatabase() {
+		return nil
+	}
+	var imported int
+	if err := store.db.QueryRow(`SELECT COUNT(*) FROM imports WHERE name = ?`, tiedotImportName).Scan(&imported); err != nil {
+		return err
+	}
+	if imported > 0 {
+		log.Println(color.YellowString("Old database was already migrated, moving it out of the way..."))
+		_, err := moveTiedotDatabase()
+		return err
+	}
+	log.Println(color.YellowString("Migrating database from an older version, please wait..."))
+
+	oldDB, err := db.OpenDB(databasePath)
+	if err != nil {
+		return err
+	}
+
+	var downloads []*download
+	if collection := oldDB.Use("Downloads"); collection != nil {
+		collection.ForEachDoc(func(id int, docContent []byte) (willMoveOn bool) {
+			var doc map[string]interface{}
+			if err := json.Unmarshal(docContent, &doc); err != nil {
+				log.Println(color.HiRedString("Failed to read old download record %d:\t%s", id, err))
+				return true
+			}
+			getString := func(key string) string {
+				value, _ := doc[key].(string)
+				return value
+			}
+			downloads = append(downloads, &download{
+				URL:         getString("URL"),
+				Time:        parseTiedotTime(getString("Time")),
+				Destination: getString("Destination"),
+				Filename:    getString("Filename"),
+				ChannelID:   getString("ChannelID"),
+				UserID:      getString("UserID"),
+			})
+			return true
+		})
+	}
+
+	var jobs []string
+	if collection := oldDB.Use("Queue"); collection != nil {
+		collection.ForEachDoc(func(id int, docContent []byte) (willMoveOn bool) {
+			var doc map[string]interface{}
+			if err := json.Unmarshal(docContent, &doc); err == nil {
+				if job, ok := doc["Job"].(string); ok {
+					jobs = append(jobs, job)
+				}
+			}
+			return true
+		})
+	}
+	oldDB.Close()
+
+	tx, err := store.db.Begin()
+	if err != nil {
+		return err
+	}
+	for _, download := range downloads {
+		_, err := tx.Exec(`INSERT INTO downloads (url, time, destination, filename, channel_id, user_id) VALUES (?, ?, ?, ?, ?, ?)`,
+			download.URL, download.Time.Format(time.RFC3339Nano), download.Destination, download.Filename, download.ChannelID, download.UserID)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	for _, job := range jobs {
+		if _, err := tx.Exec(`INSERT INTO queue (job) VALUES (?)`, job); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	if _, err := tx.Exec(`INSERT INTO imports (name, time) VALUES (?, ?)`, tiedotImportName, time.Now().Format(time.RFC3339Nano)); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	backupPath, err := moveTiedotDatabase()
+	if err != nil {
+		return err
+	}
+	log.Println(color.HiYellowString("Migrated %d download record(s) and %d queued download(s), old database moved to \"%s\"",
+		len(downloads), len(jobs), backupPath))
+	return nil
+}
+
+// Moves the old collections into a backup folder, returns its path
+func moveTiedotDatabase() (string, error) {
+	backupPath := filepath.Join(databasePath, "tiedot-backup")
+	if err := os.MkdirAll(backupPath, 0755); err != nil {
+		return "", err
+	}
+	for _, collection := range tiedotCollections {
+		collectionPath := filepath.Join(databasePath, collection)
+		if _, err := os.Stat(collectionPath); err != nil {
+			continue
+		}
+		if err := os.Rename(collectionPath, filepath.Join(backupPath, collection)); err != nil {
+			return "", err
+		}
+	}
+	return backupPath, nil
+}
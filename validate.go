@@ -0,0 +1,300 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Points JSON errors at the line & column they happened on
+func describeJSONError(data []byte, err error) error {
+	var offset int64 = -1
+	var syntaxError *json.SyntaxError
+	var typeError *json.UnmarshalTypeError
+	if errors.As(err, &syntaxError) {
+		offset = syntaxError.Offset - 1 // offset is just after the character
+	} else if errors.As(err, &typeError) {
+		offset = typeError.Offset
+	}
+	if offset < 0 {
+		return err
+	}
+	if offset > int64(len(data)) {
+		offset = int64(len(data))
+	}
+	line, column := 1, 1
+	for _, b := range data[:offset] {
+		if b == '\n' {
+			line++
+			column = 1
+		} else {
+			column++
+		}
+	}
+	return fmt.Errorf("line %d, column %d: %s", line, column, err)
+}
+
+// Keys in the settings file that don't match any setting, these are ignored when decoding so typos go unnoticed
+func findUnknownSettings(data []byte) []string {
+	var raw interface{}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil
+	}
+	var unknown []string
+	checkUnknownSettings(raw, reflect.TypeOf(configuration{}), "", &unknown)
+	return unknown
+}
+
+func checkUnknownSettings(value interface{}, t reflect.Type, path string, unknown *[]string) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.Struct:
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return
+		}
+		// Decoding matches names case-insensitively, so this does too
+		fields := make(map[string]reflect.Type)
+		var names []string
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			name := strings.Split(field.Tag.Get("json"), ",")[0]
+			if name == "-" {
+				continue
+			}
+			if name == "" {
+				name = field.Name
+			}
+			fields[strings.ToLower(name)] = field.Type
+			names = append(names, name)
+		}
+		keys := make([]string, 0, len(object))
+		for key := range object {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			keyPath := key
+			if path != "" {
+				keyPath = path + "." + key
+			}
+			fieldType, known := fields[strings.ToLower(key)]
+			if !known {
+				message := fmt.Sprintf("unknown setting \"%s\" is ignored", keyPath)
+				if suggestion := closestSettingName(key, names); suggestion != "" {
+					message += fmt.Sprintf(", did you mean \"%s\"?", suggestion)
+				}
+				*unknown = append(*unknown, message)
+				continue
+			}
+			checkUnknownSettings(object[key], fieldType, keyPath, unknown)
+		}
+	case reflect.Slice:
+		list, ok := value.([]interface{})
+		if !ok {
+			return
+		}
+		for i, item := range list {
+			checkUnknownSettings(item, t.Elem(), fmt.Sprintf("%s[%d]", path, i), unknown)
+		}
+	}
+}
+
+// The setting name a typo most likely meant, "" if none is close
+func closestSettingName(key string, names []string) string {
+	best, bestDistance := "", len(key)/4+2
+	for _, name := range names {
+		if distance := levenshteinDistance(strings.ToLower(key), strings.ToLower(name)); distance < bestDistance {
+			best, bestDistance = name, distance
+		}
+	}
+	return best
+}
+
+func levenshteinDistance(a string, b string) int {
+	previous := make([]int, len(b)+1)
+	current := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			current[j] = minInt(minInt(previous[j]+1, current[j-1]+1), previous[j-1]+cost)
+		}
+		previous, current = current, previous
+	}
+	return previous[len(b)]
+}
+
+func minInt(a int, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// Same formats getEmbedColor understands
+func isValidEmbedColor(value string) bool {
+	switch value {
+	case "", "role", "user", "random", "rand":
+		return true
+	}
+	if converted, err := strconv.ParseUint(strings.ReplaceAll(value, "#", ""), 16, 64); err == nil {
+		return converted <= 0xFFFFFF
+	}
+	if converted, err := strconv.Atoi(value); err == nil {
+		return converted >= 0 && converted <= 0xFFFFFF
+	}
+	return false
+}
+
+// Date formats are Go layouts, anything else comes out unchanged
+func checkDateFormat(name string, layout string) string {
+	if layout == "" {
+		return ""
+	}
+	// Any date but the one layouts are written as
+	formatted := time.Date(1999, 11, 28, 21, 37, 48, 0, time.UTC).Format(layout)
+	if formatted == layout {
+		return fmt.Sprintf("%s \"%s\" has no date in it, formats are written as the date 2006-01-02 15:04:05 (e.g. \"2006-01-02_15-04-05 \")", name, layout)
+	}
+	for _, key := range filenameBlacklist {
+		if strings.Contains(formatted, key) {
+			return fmt.Sprintf("%s \"%s\" contains \"%s\", which is removed from file names", name, layout, key)
+		}
+	}
+	return ""
+}
+
+// Whether the bot can save files into a folder, it's created on first download if missing
+func checkDestinationWritable(destination string) error {
+	folder := destination
+	for {
+		info, err := os.Stat(folder)
+		if err == nil {
+			if !info.IsDir() {
+				return fmt.Errorf("\"%s\" is a file, not a folder", folder)
+			}
+			break
+		}
+		if !os.IsNotExist(err) {
+			return err
+		}
+		parent := filepath.Dir(folder)
+		if parent == folder {
+			return err
+		}
+		folder = parent
+	}
+	file, err := ioutil.TempFile(folder, ".write-check-")
+	if err != nil {
+		return fmt.Errorf("\"%s\" is not writable", folder)
+	}
+	file.Close()
+	os.Remove(file.Name())
+	return nil
+}
+
+// Problems with settings beyond their syntax, errors mean they can't be used
+func validateConfig(c *configuration) (problems []string, warnings []string) {
+	// Registration
+	registeredBy := make(map[string]int)
+	register := func(i int, kind string, id string) {
+		key := kind + " " + id
+		if first, exists := registeredBy[key]; exists && first != i {
+			problems = append(problems, fmt.Sprintf("%s is registered by both channels[%d] and channels[%d]", key, first, i))
+			return
+		}
+		registeredBy[key] = i
+	}
+
+	checkedDestinations := make(map[string]bool)
+	for i, channel := range c.Channels {
+		if channel.ChannelID == "" && (channel.ChannelIDs == nil || len(*channel.ChannelIDs) == 0) &&
+			channel.GuildID == "" && channel.CategoryID == "" {
+			problems = append(problems, fmt.Sprintf("channels[%d] has no channel, channels, category or guild", i))
+		}
+		if channel.ChannelID != "" {
+			register(i, "channel", channel.ChannelID)
+		}
+		if channel.ChannelIDs != nil {
+			for _, channelID := range *channel.ChannelIDs {
+				register(i, "channel", channelID)
+			}
+		}
+		if channel.CategoryID != "" {
+			register(i, "category", channel.CategoryID)
+		} else if channel.GuildID != "" {
+			register(i, "guild", channel.GuildID)
+		}
+
+		if channel.Destination == "" {
+			problems = append(problems, fmt.Sprintf("channels[%d] has no destination", i))
+		} else if !checkedDestinations[channel.Destination] {
+			checkedDestinations[channel.Destination] = true
+			// A drive that isn't mounted yet shouldn't stop the bot, downloads there fail until it is
+			if err := checkDestinationWritable(channel.Destination); err != nil {
+				warnings = append(warnings, fmt.Sprintf("channels[%d] destination can't be saved to: %s", i, err))
+			}
+		}
+
+		if channel.OverwriteEmbedColor != nil && !isValidEmbedColor(*channel.OverwriteEmbedColor) {
+			problems = append(problems, fmt.Sprintf("channels[%d] overwriteEmbedColor \"%s\" is not a color, use random, role or RGB like #FF0000", i, *channel.OverwriteEmbedColor))
+		}
+		if channel.OverwriteFilenameDateFormat != nil {
+			if warning := checkDateFormat(fmt.Sprintf("channels[%d] overwriteFilenameDateFormat", i), *channel.OverwriteFilenameDateFormat); warning != "" {
+				warnings = append(warnings, warning)
+			}
+		}
+		if channel.DateSource != nil {
+			switch *channel.DateSource {
+			case dateSourceMessage, dateSourceDownload, dateSourceLastModified:
+			default:
+				problems = append(problems, fmt.Sprintf("channels[%d] dateSource \"%s\" is not one of %s, %s or %s",
+					i, *channel.DateSource, dateSourceMessage, dateSourceDownload, dateSourceLastModified))
+			}
+		}
+		if channel.DuplicatePolicy != nil {
+			switch *channel.DuplicatePolicy {
+			case duplicatePolicySave, duplicatePolicySkip, duplicatePolicyHardlink, duplicatePolicySymlink:
+			default:
+				problems = append(problems, fmt.Sprintf("channels[%d] duplicatePolicy \"%s\" is not one of %s, %s, %s or %s",
+					i, *channel.DuplicatePolicy, duplicatePolicySave, duplicatePolicySkip, duplicatePolicyHardlink, duplicatePolicySymlink))
+			}
+		}
+	}
+
+	adminChannels := make(map[string]bool)
+	for i, channel := range c.AdminChannels {
+		if channel.ChannelID == "" {
+			problems = append(problems, fmt.Sprintf("adminChannels[%d] has no channel", i))
+		} else if adminChannels[channel.ChannelID] {
+			warnings = append(warnings, fmt.Sprintf("adminChannels[%d] channel %s is listed more than once", i, channel.ChannelID))
+		}
+		adminChannels[channel.ChannelID] = true
+	}
+
+	// Appearance
+	if c.EmbedColor != nil && !isValidEmbedColor(*c.EmbedColor) {
+		problems = append(problems, fmt.Sprintf("embedColor \"%s\" is not a color, use random, role or RGB like #FF0000", *c.EmbedColor))
+	}
+	if warning := checkDateFormat("filenameDateFormat", c.FilenameDateFormat); warning != "" {
+		warnings = append(warnings, warning)
+	}
+	return problems, warnings
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDescribeJSONError(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want string // start of the message, "" if the error should come back unchanged
+	}{
+		{"missing comma", "{\n\t\"debugOutput\": true\n\t\"commandPrefix\": \"ddg \"\n}", "line 3, column 2: "},
+		{"trailing comma", "{\n\t\"debugOutput\": true,\n}", "line 3, column 1: "},
+		{"first character", "x", "line 1, column 1: "},
+		{"not JSON at all", "", ""},
+		{"wrong type", "{\n\t\"debugOutput\": \"yes\"\n}", "line 2, column "},
+		{"cut short", "{\n\t\"debugOutput\": ", "line 2, column 16: "},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			data := []byte(test.data)
+			original := json.Unmarshal(data, defaultConfiguration())
+			if original == nil {
+				t.Fatal("expected the settings not to decode")
+			}
+			err := describeJSONError(data, original)
+			if test.want == "" {
+				if err != original {
+					t.Errorf("got %q, want the error unchanged", err)
+				}
+				return
+			}
+			if !strings.HasPrefix(err.Error(), test.want) {
+				t.Errorf("got %q, want it to start with %q", err, test.want)
+			}
+		})
+	}
+
+	other := errors.New("something else")
+	if err := describeJSONError(nil, other); err != other {
+		t.Errorf("got %q, want other errors unchanged", err)
+	}
+}
+
+func TestFindUnknownSettings(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want []string
+	}{
+		{"all known", `{"debugOutput": true, "credentials": {"token": "x"}}`, nil},
+		{"names ignore case", `{"DebugOutput": true, "CREDENTIALS": {"Token": "x"}}`, nil},
+		{"typo", `{"debugOutptu": true}`,
+			[]string{`unknown setting "debugOutptu" is ignored, did you mean "debugOutput"?`}},
+		{"nothing close", `{"zzzzzzzzzzzz": 1}`, []string{`unknown setting "zzzzzzzzzzzz" is ignored`}},
+		{"nested", `{"credentials": {"tokne": "x"}}`,
+			[]string{`unknown setting "credentials.tokne" is ignored, did you mean "token"?`}},
+		{"in a list", `{"channels": [{"channel": "1"}, {"channel": "2", "destinaton": "x"}]}`,
+			[]string{`unknown setting "channels[1].destinaton" is ignored, did you mean "destination"?`}},
+		{"sorted", `{"b_unknown": 1, "a_unknown": 1}`,
+			[]string{`unknown setting "a_unknown" is ignored`, `unknown setting "b_unknown" is ignored`}},
+		{"wrong type isn't looked into", `{"channels": {"channel": "1"}}`, nil},
+		{"invalid JSON", `{`, nil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := findUnknownSettings([]byte(test.data)); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestIsValidEmbedColor(t *testing.T) {
+	tests := []struct {
+		value string
+		want  bool
+	}{
+		{"", true},
+		{"role", true},
+		{"user", true},
+		{"random", true},
+		{"rand", true},
+		{"#FF0000", true},
+		{"ff0000", true},
+		{"#ffffff", true},
+		{"123456", true},
+		{"#1000000", false},
+		{"16777215", false}, // digits are read as hex first, like getEmbedColor does
+		{"red", false},
+		{"-1", false},
+	}
+	for _, test := range tests {
+		if got := isValidEmbedColor(test.value); got != test.want {
+			t.Errorf("isValidEmbedColor(%q) = %v, want %v", test.value, got, test.want)
+		}
+	}
+}
+
+func TestCheckDateFormat(t *testing.T) {
+	tests := []struct {
+		layout string
+		want   string // part of the warning, "" for none
+	}{
+		{"", ""},
+		{"2006-01-02_15-04-05 ", ""},
+		{"20060102 ", ""},
+		{"Jan 2 2006 ", ""},
+		{"yyyy-mm-dd ", "has no date in it"},
+		{"2006/01/02 ", `contains "/"`},
+	}
+	for _, test := range tests {
+		got := checkDateFormat("filenameDateFormat", test.layout)
+		if test.want == "" && got != "" {
+			t.Errorf("checkDateFormat(%q) = %q, want no warning", test.layout, got)
+		} else if !strings.Contains(got, test.want) {
+			t.Errorf("checkDateFormat(%q) = %q, want it to mention %q", test.layout, got, test.want)
+		}
+	}
+}
+
+func TestValidateConfigDestination(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "file")
+	if err := os.WriteFile(file, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name        string
+		destination string
+		problem     string // part of the problem, "" for none
+		warning     string // part of the warning, "" for none
+	}{
+		{"writable", t.TempDir(), "", ""},
+		{"missing folder is created later", filepath.Join(t.TempDir(), "new", "folder"), "", ""},
+		{"unwritable is only a warning", filepath.Join(file, "folder"), "", "destination can't be saved to"},
+		{"none", "", "has no destination", ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			problems, warnings := validateConfig(&configuration{
+				Channels: []configurationChannel{{ChannelID: "1", Destination: test.destination}},
+			})
+			for _, check := range []struct {
+				kind string
+				got  []string
+				want string
+			}{{"problems", problems, test.problem}, {"warnings", warnings, test.warning}} {
+				joined := strings.Join(check.got, "\n")
+				if (check.want == "") != (joined == "") || !strings.Contains(joined, check.want) {
+					t.Errorf("%s = %q, want %q", check.kind, check.got, check.want)
+				}
+			}
+		})
+	}
+}
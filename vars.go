@@ -12,9 +12,11 @@ const (
 	projectReleaseURL    = "https://github.com/get-got/discord-downloader-go/releases/latest"
 	projectReleaseApiURL = "https://api.github.com/repos/get-got/discord-downloader-go/releases/latest"
 
-	configPath   = "settings.json"
-	databasePath = "database"
-	imgStorePath = databasePath + "/imgStore"
+	configPath       = "settings.json"
+	databasePath     = "database"
+	databaseFilePath = databasePath + "/database.sqlite"
+	imgStorePath     = databasePath + "/imgStore"
+	exportsPath      = databasePath + "/exports"
 
 	imgurClientID = "08af502a9e70d65"
 )
@@ -43,7 +45,7 @@ var (
 )
 
 // Multiple use messages to save space and make cleaner.
-//TODO: Implement this for more?
+// TODO: Implement this for more?
 const (
 	cmderrLackingLocalAdminPerms = "You do not have permission to use this command.\n" +
 		"\nTo use this command you must:" +
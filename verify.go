@@ -0,0 +1,376 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/fatih/color"
+	"github.com/hako/durafmt"
+)
+
+const (
+	verifyActionNone    = ""
+	verifyActionPurge   = "purge"   // delete records of missing/changed files
+	verifyActionRequeue = "requeue" // delete them and download the links again
+)
+
+var (
+	verifyRunning      bool
+	verifyRunningMutex sync.Mutex
+)
+
+type verifyOptions struct {
+	Filter  downloadFilter
+	Action  string
+	Orphans bool // also look for files in channel destinations that have no record
+}
+
+type verifyResult struct {
+	Checked    int
+	Total      int
+	Missing    []*download
+	Mismatched []*download
+	Orphaned   []string
+	Purged     int
+	Requeued   int
+}
+
+// Marks a verification as running, false if one already is
+func startVerify() bool {
+	verifyRunningMutex.Lock()
+	defer verifyRunningMutex.Unlock()
+	if verifyRunning {
+		return false
+	}
+	verifyRunning = true
+	return true
+}
+
+func stopVerify() {
+	verifyRunningMutex.Lock()
+	verifyRunning = false
+	verifyRunningMutex.Unlock()
+}
+
+// Checks each download record against the file on disk, progress is called every so often while checking
+func verifyDownloads(options verifyOptions, progress func(result *verifyResult)) (*verifyResult, error) {
+	logPrefixHere := color.CyanString("[verifyDownloads]")
+	records, err := myDB.FindDownloads(options.Filter)
+	if err != nil {
+		return nil, err
+	}
+	result := &verifyResult{Total: len(records)}
+	lastProgress := time.Now()
+
+	for _, record := range records {
+		if progress != nil && time.Since(lastProgress) > 5*time.Second {
+			progress(result)
+			lastProgress = time.Now()
+		}
+		result.Checked++
+		if record.Destination == "" {
+			continue
+		}
+		if _, err := os.Stat(record.Destination); err != nil {
+			log.Println(logPrefixHere, color.YellowString("Missing file for %s: %s", record.URL, record.Destination))
+			result.Missing = append(result.Missing, record)
+			continue
+		}
+		if record.Hash != "" {
+			hash, _, err := getFileHash(record.Destination)
+			if err != nil {
+				log.Println(logPrefixHere, color.HiRedString("Failed to hash \"%s\":\t%s", record.Destination, err))
+			} else if hash != record.Hash {
+				log.Println(logPrefixHere, color.YellowString("File changed since download for %s: %s", record.URL, record.Destination))
+				result.Mismatched = append(result.Mismatched, record)
+			}
+		}
+	}
+
+	if options.Orphans {
+		result.Orphaned = findOrphanedFiles(options.Filter.ChannelID)
+	}
+
+	if options.Action != verifyActionNone {
+		stale := append(append([]*download{}, result.Missing...), result.Mismatched...)
+		requeued := make(map[string]bool)
+		for _, record := range stale {
+			if err := myDB.DeleteDownload(record.ID); err != nil {
+				log.Println(logPrefixHere, color.HiRedString("Failed to delete record %d:\t%s", record.ID, err))
+				continue
+			}
+			result.Purged++
+			// Several files can come from one link, only queue it once
+			key := partialDownloadKey(record.URL, record.ChannelID)
+			if options.Action == verifyActionRequeue && !requeued[key] {
+				requeued[key] = true
+				requeueDownload(record)
+				result.Requeued++
+			}
+		}
+	}
+	return result, nil
+}
+
+// Queues the link of a record again, with as much of the original message as can still be found
+func requeueDownload(record *download) {
+	file := &fileItem{
+		Link:       record.URL,
+		SourceLink: record.SourceURL,
+		Filename:   record.Filename,
+		Time:       snowflakeToTime(record.MessageID), // record times are when it was downloaded
+		Extractor:  record.Extractor,
+	}
+	if downloader := getExternalDownloader(record.URL); downloader != nil && downloader.Program == record.Extractor {
+		file.External = true
+	}
+	message := &discordgo.Message{
+		ID:        record.MessageID,
+		ChannelID: record.ChannelID,
+		GuildID:   record.GuildID,
+		Author:    &discordgo.User{ID: record.UserID},
+	}
+
+	// Attachment links are signed & expire, the message has current ones
+	if bot != nil && record.MessageID != "" {
+		if fetched, err := bot.ChannelMessage(record.ChannelID, record.MessageID); err == nil {
+			if fetched.GuildID == "" {
+				fetched.GuildID = record.GuildID
+			}
+			message = fetched
+			if attachmentURL := findAttachmentURL(fetched, record.URL); attachmentURL != "" {
+				file.Link = attachmentURL
+			}
+		} else if isAttachmentURL(record.URL) {
+			log.Println(color.YellowString("Couldn't fetch message %s for a current link to %s, it may have expired:\t%s",
+				record.MessageID, record.URL, err))
+		}
+	}
+
+	queueDownload(&downloadJob{
+		File:       file,
+		Path:       getChannelConfig(record.ChannelID).Destination,
+		Message:    message,
+		HistoryCmd: true,
+	})
+}
+
+func isAttachmentURL(link string) bool {
+	u, err := url.Parse(link)
+	if err != nil {
+		return false
+	}
+	host := strings.ToLower(u.Hostname())
+	return (host == "cdn.discordapp.com" || host == "media.discordapp.net") && strings.HasPrefix(u.Path, "/attachments/")
+}
+
+// The message's current link for an attachment, matched on everything but the signature
+func findAttachmentURL(message *discordgo.Message, link string) string {
+	if !isAttachmentURL(link) {
+		return ""
+	}
+	u, _ := url.Parse(link)
+	for _, attachment := range message.Attachments {
+		if current, err := url.Parse(attachment.URL); err == nil && current.Path == u.Path {
+			return attachment.URL
+		}
+	}
+	return ""
+}
+
+// Absolute paths of every file in the database
+func getRecordedDestinations() (map[string]bool, error) {
+	records, err := myDB.FindDownloads(downloadFilter{})
+	if err != nil {
+		return nil, err
+	}
+	known := make(map[string]bool)
+	for _, record := range records {
+		if record.Destination == "" {
+			continue
+		}
+		if path, err := filepath.Abs(record.Destination); err == nil {
+			known[path] = true
+		}
+	}
+	return known, nil
+}
+
+// Skips work files the bot keeps next to downloads
+func isDownloadWorkFile(path string) bool {
+	return strings.HasSuffix(path, partialFileSuffix) || strings.HasSuffix(path, partialMetaSuffix) ||
+		strings.HasSuffix(path, ".link")
+}
+
+// Files under channel destinations that no download record points to
+func findOrphanedFiles(channelID string) []string {
+	config := getConfig()
+	logPrefixHere := color.CyanString("[findOrphanedFiles]")
+	var roots []string
+	var ignored []string
+	for i, channel := range config.Channels {
+		if channelID != "" && !stringInSlice(channelID, getRegisteredChannels(config, i)) {
+			continue
+		}
+		if channel.Destination != "" && !stringInSlice(channel.Destination, roots) {
+			roots = append(roots, channel.Destination)
+		}
+		if channel.SaveAllLinksToFile != nil {
+			if path, err := filepath.Abs(*channel.SaveAllLinksToFile); err == nil {
+				ignored = append(ignored, path)
+			}
+		}
+	}
+
+	// Every file recorded anywhere, so folders shared between channels don't report each other's files
+	known, err := getRecordedDestinations()
+	if err != nil {
+		log.Println(logPrefixHere, color.HiRedString("Failed to read database:\t%s", err))
+		return nil
+	}
+
+	var orphaned []string
+	for _, root := range roots {
+		filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return nil
+			}
+			if info.IsDir() {
+				if strings.HasPrefix(info.Name(), ".external-") {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if isDownloadWorkFile(path) {
+				return nil
+			}
+			absolute, err := filepath.Abs(path)
+			if err != nil || known[absolute] || stringInSlice(absolute, ignored) {
+				return nil
+			}
+			log.Println(logPrefixHere, color.YellowString("No record for file: %s", path))
+			orphaned = append(orphaned, path)
+			return nil
+		})
+	}
+	return orphaned
+}
+
+// Lists up to a few paths for an embed
+func formatVerifyList(paths []string) string {
+	const limit = 5
+	text := ""
+	for i, path := range paths {
+		if i == limit {
+			text += fmt.Sprintf("\n_...and %s more_", formatNumber(int64(len(paths)-limit)))
+			break
+		}
+		text += fmt.Sprintf("\n``%s``", path)
+	}
+	return text
+}
+
+func (result *verifyResult) summary(startTime time.Time, options verifyOptions) string {
+	var missing, mismatched []string
+	for _, record := range result.Missing {
+		missing = append(missing, record.Destination)
+	}
+	for _, record := range result.Mismatched {
+		mismatched = append(mismatched, record.Destination)
+	}
+	content := fmt.Sprintf("``%s:`` **Checked %s download record(s)**\n\n"+
+		"• **Missing Files —** %s%s\n"+
+		"• **Changed Files —** %s%s\n",
+		durafmt.ParseShort(time.Since(startTime)).String(),
+		formatNumber(int64(result.Checked)),
+		formatNumber(int64(len(result.Missing))), formatVerifyList(missing),
+		formatNumber(int64(len(result.Mismatched))), formatVerifyList(mismatched),
+	)
+	if options.Orphans {
+		content += fmt.Sprintf("• **Files without a Record —** %s%s\n",
+			formatNumber(int64(len(result.Orphaned))), formatVerifyList(result.Orphaned))
+	}
+	switch options.Action {
+	case verifyActionPurge:
+		content += fmt.Sprintf("\nRemoved %s stale record(s).", formatNumber(int64(result.Purged)))
+	case verifyActionRequeue:
+		content += fmt.Sprintf("\nRemoved %s stale record(s) and queued %s link(s) to download again.",
+			formatNumber(int64(result.Purged)), formatNumber(int64(result.Requeued)))
+	}
+	return content
+}
+
+// Runs a verification for the verify command, keeping a status embed up to date like history does
+func handleVerify(commandingMessage *discordgo.Message, options verifyOptions) {
+	logPrefixHere := color.CyanString("[handleVerify]")
+	verifyStartTime := time.Now()
+
+	message, err := replyEmbed(commandingMessage, "Command — Verify", "Checking downloaded files, please wait...")
+	if err != nil {
+		log.Println(logPrefixHere, color.HiRedString("Failed to send command embed message (requested by %s):\t%s", getUserIdentifier(*commandingMessage.Author), err))
+	}
+	log.Println(logPrefixHere, color.HiCyanString("%s began verifying downloads", getUserIdentifier(*commandingMessage.Author)))
+
+	updateStatus := func(content string) {
+		if message == nil {
+			log.Println(logPrefixHere, color.HiRedString("Tried to edit status message but it doesn't exist."))
+			return
+		}
+		edited, err := bot.ChannelMessageEditComplex(&discordgo.MessageEdit{
+			ID:      message.ID,
+			Channel: message.ChannelID,
+			Embed:   buildEmbed(message.ChannelID, "Command — Verify", content),
+		})
+		if err != nil {
+			log.Println(logPrefixHere, color.RedString("Failed to edit status message, sending new one:\t%s", err))
+			edited, err = replyEmbed(commandingMessage, "Command — Verify", content)
+			if err != nil {
+				log.Println(logPrefixHere, color.HiRedString("Failed to send replacement status message:\t%s", err))
+			}
+		}
+		message = edited
+	}
+
+	result, err := verifyDownloads(options, func(result *verifyResult) {
+		updateStatus(fmt.Sprintf("``%s:`` %s of %s download record(s) checked, %s missing, %s changed\n_Still checking, please wait..._",
+			durafmt.ParseShort(time.Since(verifyStartTime)).String(),
+			formatNumber(int64(result.Checked)), formatNumber(int64(result.Total)),
+			formatNumber(int64(len(result.Missing))), formatNumber(int64(len(result.Mismatched)))))
+	})
+	if err != nil {
+		log.Println(logPrefixHere, color.HiRedString("Verification failed:\t%s", err))
+		updateStatus(fmt.Sprintf("Verification failed: %s", err))
+		return
+	}
+	updateStatus(result.summary(verifyStartTime, options))
+
+	log.Println(logPrefixHere, color.HiCyanString("Finished verifying %d download record(s) (requested by %s): %d missing, %d changed, %d without a record",
+		result.Checked, getUserIdentifier(*commandingMessage.Author), len(result.Missing), len(result.Mismatched), len(result.Orphaned)))
+}
+
+// Reads command arguments like "requeue orphans channel:<id>"
+func parseVerifyArgs(args []string) (verifyOptions, error) {
+	var options verifyOptions
+	for _, arg := range args {
+		arg = strings.ToLower(strings.TrimSpace(arg))
+		switch {
+		case arg == "":
+		case arg == verifyActionPurge || arg == verifyActionRequeue:
+			options.Action = arg
+		case arg == "orphans":
+			options.Orphans = true
+		case strings.HasPrefix(arg, "channel:"):
+			options.Filter.ChannelID = strings.TrimPrefix(arg, "channel:")
+		default:
+			return options, fmt.Errorf("unknown option \"%s\"", arg)
+		}
+	}
+	return options, nil
+}